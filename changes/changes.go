@@ -12,7 +12,7 @@ package changes
 //--------------------
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/tideland/gocouch/couchdb"
 )
@@ -27,6 +27,12 @@ func Changes(cdb couchdb.CouchDB, params ...couchdb.Parameter) ResultSet {
 	return newResultSet(rs)
 }
 
+// ChangesContext returns access to the changes of the database
+// using the passed context.
+func ChangesContext(ctx context.Context, cdb couchdb.CouchDB, params ...couchdb.Parameter) ResultSet {
+	return Changes(cdb.WithContext(ctx), params...)
+}
+
 //--------------------
 // CHANGES RESULT SET
 //--------------------
@@ -58,6 +64,10 @@ type ResultSet interface {
 	// Do iterates over the results of a ResultSet and
 	// processes the content.
 	Do(process Processor) error
+
+	// Changes returns all changes including the conflicts
+	// of included documents.
+	Changes() ([]Change, error)
 }
 
 // resultSet implements the ResultSet interface.
@@ -94,7 +104,7 @@ func (rs *resultSet) LastSequence() string {
 	if err := rs.readChanges(); err != nil {
 		return ""
 	}
-	return fmt.Sprintf("%v", rs.changes.LastSequence)
+	return string(rs.changes.LastSequence)
 }
 
 // Pending implements the ResultSet interface.
@@ -119,19 +129,31 @@ func (rs *resultSet) Do(process Processor) error {
 		return err
 	}
 	for _, result := range rs.changes.Results {
-		revisions := []string{}
-		for _, change := range result.Changes {
-			revisions = append(revisions, change.Revision)
-		}
-		seq := fmt.Sprintf("%v", result.Sequence)
+		revisions := result.Changes.revisions()
 		doc := couchdb.NewUnmarshableJSON(result.Document)
-		if err := process(result.ID, seq, result.Deleted, revisions, doc); err != nil {
+		if err := process(result.ID, string(result.Sequence), result.Deleted, revisions, doc); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Changes implements the ResultSet interface.
+func (rs *resultSet) Changes() ([]Change, error) {
+	if err := rs.readChanges(); err != nil {
+		return nil, err
+	}
+	changes := make([]Change, len(rs.changes.Results))
+	for i, result := range rs.changes.Results {
+		change, err := newChange(result)
+		if err != nil {
+			return nil, err
+		}
+		changes[i] = change
+	}
+	return changes, nil
+}
+
 // readChanges lazily reads the changes out of the CouchDB result set.
 func (rs *resultSet) readChanges() error {
 	if !rs.IsOK() {
@@ -152,4 +174,22 @@ func (rs *resultSet) readChanges() error {
 // HELPERS
 //--------------------
 
+// newChange creates a change out of a result. The conflicts
+// are taken from the included document.
+func newChange(result couchdbChangesResult) (Change, error) {
+	change := Change{
+		ID:        result.ID,
+		Sequence:  string(result.Sequence),
+		Deleted:   result.Deleted,
+		Revisions: result.Changes.revisions(),
+		Document:  couchdb.NewUnmarshableJSON(result.Document),
+	}
+	conflicts, err := result.conflicts()
+	if err != nil {
+		return Change{}, err
+	}
+	change.Conflicts = conflicts
+	return change, nil
+}
+
 // EOF
@@ -12,8 +12,18 @@ package changes_test
 //--------------------
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/tideland/golib/audit"
 	"github.com/tideland/golib/etc"
@@ -22,6 +32,7 @@ import (
 
 	"github.com/tideland/gocouch/changes"
 	"github.com/tideland/gocouch/couchdb"
+	"github.com/tideland/gocouch/find"
 )
 
 //--------------------
@@ -79,6 +90,440 @@ func TestChanges(t *testing.T) {
 	assert.Equal(rs.Len(), count)
 }
 
+// TestFilteredChanges tests retrieving changes filtered by
+// document IDs and selectors.
+func TestFilteredChanges(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, _, cleanup := prepareFilledDatabase(assert, "changes-filtered", 100)
+	defer cleanup()
+
+	ids := []string{"filtered-1", "filtered-2", "filtered-3"}
+	for _, id := range ids {
+		rs := cdb.CreateDocument(MyDocument{DocumentID: id, Age: 999})
+		assert.True(rs.IsOK())
+	}
+
+	// Filter by document IDs.
+	rs := changes.Changes(cdb, changes.FilterDocumentIDs(ids[0], ids[1]))
+	assert.True(rs.IsOK())
+	assert.Equal(rs.Len(), 2)
+
+	// Filter by selector.
+	rs = changes.Changes(cdb, changes.FilterSelector(find.Select(find.Equal("age", 999))))
+	assert.True(rs.IsOK())
+	assert.Equal(rs.Len(), 3)
+	rs = changes.Changes(cdb, changes.FilterSelector(json.RawMessage(`{"age": 999}`)))
+	assert.True(rs.IsOK())
+	assert.Equal(rs.Len(), 3)
+
+	// Both filters are kept in the body, the last one is used.
+	rs = changes.Changes(cdb, changes.FilterSelector(find.Select(find.Equal("age", 999))), changes.FilterDocumentIDs(ids[0]))
+	assert.True(rs.IsOK())
+	assert.Equal(rs.Len(), 1)
+}
+
+// TestChangesParameters tests filter functions and further
+// parameters of changes.
+func TestChangesParameters(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, _, cleanup := prepareFilledDatabase(assert, "changes-parameters", 100)
+	defer cleanup()
+
+	// Create filter function and a document in conflict.
+	filters := map[string]interface{}{
+		"filters": map[string]string{
+			"by_age": "function(doc, req) { return doc.age == req.query.age; }",
+		},
+	}
+	rs := cdb.Put(cdb.DatabasePath("_design", "filtering"), filters)
+	assert.True(rs.IsOK())
+	rs = cdb.CreateDocument(MyDocument{DocumentID: "conflicting", Age: 999})
+	assert.True(rs.IsOK())
+	rs = cdb.Put(cdb.DatabasePath("conflicting"), MyDocument{
+		DocumentID:       "conflicting",
+		DocumentRevision: "1-00000000000000000000000000000001",
+		Age:              999,
+	}, couchdb.Query(couchdb.KeyValue{Key: "new_edits", Value: "false"}))
+	assert.True(rs.IsOK())
+
+	// Filter with the function and include documents with conflicts.
+	crs := changes.Changes(cdb,
+		changes.FilterFunction("filtering", "by_age", couchdb.KeyValue{Key: "age", Value: "999"}),
+		changes.IncludeDocuments(),
+		changes.Conflicts(),
+		changes.SequenceInterval(10),
+	)
+	assert.True(crs.IsOK())
+	cs, err := crs.Changes()
+	assert.Nil(err)
+	assert.Length(cs, 1)
+	assert.Equal(cs[0].ID, "conflicting")
+	assert.Length(cs[0].Conflicts, 1)
+	doc := MyDocument{}
+	assert.Nil(cs[0].Document.Unmarshal(&doc))
+	assert.Equal(doc.Age, 999)
+	assert.True(crs.LastSequence() != "")
+
+	// Longpoll with timeout and without new changes.
+	crs = changes.Changes(cdb,
+		changes.Since(crs.LastSequence()),
+		couchdb.Query(couchdb.KeyValue{Key: "feed", Value: changes.FeedLongpoll}),
+		changes.Timeout(100*time.Millisecond),
+	)
+	assert.True(crs.IsOK())
+	assert.Equal(crs.Len(), 0)
+}
+
+// TestChangesError tests the errors of changes of a missing database.
+func TestChangesError(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, _, cleanup := prepareFilledDatabase(assert, "changes-error", 10)
+	defer cleanup()
+
+	missing := cdb.Server().Database("tgocouch-testing-changes-missing")
+	rs := changes.Changes(missing)
+	assert.False(rs.IsOK())
+	reqErr, ok := couchdb.AsRequestError(rs.Error())
+	assert.True(ok)
+	assert.Equal(reqErr.StatusCode, couchdb.StatusNotFound)
+	assert.True(errors.Is(reqErr, couchdb.ErrNotFoundStatus))
+
+	err := changes.FeedDo(missing, changes.FeedConfig{}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		return nil
+	})
+	assert.True(couchdb.IsNotFound(err))
+}
+
+// TestFeed tests the continuous feed of changes.
+func TestFeed(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	count := 100
+	cdb, gen, cleanup := prepareFilledDatabase(assert, "changes-feed", count)
+	defer cleanup()
+
+	// Read existing and new changes from the channel.
+	feed := changes.NewFeed(cdb, changes.FeedConfig{
+		Heartbeat: time.Second,
+	})
+	received := 0
+	for change := range feed.Changes() {
+		assert.Length(change.Revisions, 1)
+		received++
+		if received == count {
+			results, err := cdb.BulkWriteDocuments(generateDocuments(gen, count))
+			assert.Nil(err)
+			assert.Length(results, count)
+		}
+		if received == 2*count {
+			break
+		}
+	}
+	assert.Nil(feed.Stop())
+	assert.True(feed.LastSequence() != "")
+
+	// Process changes until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	processed := 0
+	err := changes.FeedDoContext(ctx, cdb, changes.FeedConfig{
+		Mode:  changes.FeedLongpoll,
+		Since: feed.LastSequence(),
+	}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		processed++
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(processed, 0)
+}
+
+// TestFeedReconnect tests reconnecting a feed after an interruption
+// when only some changes contain a sequence.
+func TestFeedReconnect(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	sinces := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(r.URL.Query().Get("seq_interval"), "2")
+		sinces <- r.URL.Query().Get("since")
+		if len(sinces) == 1 {
+			// First connection is interrupted.
+			fmt.Fprintln(w, `{"seq":"2-abc","id":"a","changes":[{"rev":"1-a"}]}`)
+			fmt.Fprintln(w, `{"seq":null,"id":"b","changes":[{"rev":"1-b"}]}`)
+			return
+		}
+		fmt.Fprintln(w, `{"seq":"4-def","id":"c","changes":[{"rev":"1-c"}]}`)
+		fmt.Fprintln(w, `{"last_seq":"4-def","pending":0}`)
+	}))
+	defer srv.Close()
+	cdb, err := couchdb.OpenURL(srv.URL + "/reconnect")
+	assert.Nil(err)
+
+	feed := changes.NewFeed(cdb, changes.FeedConfig{
+		Since:          "1-xyz",
+		Heartbeat:      time.Second,
+		ReconnectDelay: 10 * time.Millisecond,
+	}, changes.SequenceInterval(2))
+	ids := []string{}
+	for change := range feed.Changes() {
+		ids = append(ids, change.ID)
+		if len(ids) == 3 {
+			break
+		}
+	}
+	assert.Nil(feed.Stop())
+	assert.Equal(ids, []string{"a", "b", "c"})
+	assert.Equal(<-sinces, "1-xyz")
+	assert.Equal(<-sinces, "2-abc")
+	assert.Equal(feed.LastSequence(), "4-def")
+}
+
+// TestFeedSlowProcessor tests that a processor slower than the
+// heartbeat doesn't cancel a healthy connection.
+func TestFeedSlowProcessor(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		fmt.Fprintln(w, `{"seq":"1-a","id":"a","changes":[{"rev":"1-a"}]}`)
+		w.(http.Flusher).Flush()
+		for i := 0; i < 6; i++ {
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintln(w)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprintln(w, `{"seq":"2-b","id":"b","changes":[{"rev":"1-b"}]}`)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+				fmt.Fprintln(w)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer srv.Close()
+	cdb, err := couchdb.OpenURL(srv.URL + "/slow")
+	assert.Nil(err)
+
+	errDone := errors.New("done")
+	ids := []string{}
+	err = changes.FeedDo(cdb, changes.FeedConfig{
+		Heartbeat:      50 * time.Millisecond,
+		ReconnectDelay: 10 * time.Millisecond,
+	}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		time.Sleep(250 * time.Millisecond)
+		ids = append(ids, id)
+		if len(ids) == 2 {
+			return errDone
+		}
+		return nil
+	})
+	assert.Equal(err, errDone)
+	assert.Equal(ids, []string{"a", "b"})
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(requests, 1)
+}
+
+// TestConsumer tests consuming changes with checkpoints.
+func TestConsumer(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	count := 100
+	cdb, _, cleanup := prepareFilledDatabase(assert, "changes-consumer", count)
+	defer cleanup()
+
+	// Fail in the middle, the checkpoint stays at the last batch.
+	stop := errors.New("stop")
+	processed := 0
+	err := changes.Consume(cdb, changes.ConsumerConfig{
+		Name:      "test",
+		BatchSize: 10,
+	}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		processed++
+		if processed == 55 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(err, stop)
+	store := changes.NewLocalCheckpointStore(cdb)
+	checkpoint, err := store.ReadCheckpoint("test")
+	assert.Nil(err)
+	assert.True(checkpoint != "")
+
+	// Resume after the checkpoint until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resumed := 0
+	err = changes.ConsumeContext(ctx, cdb, changes.ConsumerConfig{
+		Name:        "test",
+		BatchSize:   10,
+		PollTimeout: 100 * time.Millisecond,
+	}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		resumed++
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(resumed, count-50)
+
+	// A consumer with another name starts from the beginning.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other := 0
+	err = changes.ConsumeContext(ctx, cdb, changes.ConsumerConfig{
+		Name:        "other",
+		PollTimeout: 100 * time.Millisecond,
+	}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		other++
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(other, count)
+
+	// Process in parallel, the checkpoint is the same.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	parallel := 0
+	err = changes.ConsumeContext(ctx, cdb, changes.ConsumerConfig{
+		Name:        "parallel",
+		Workers:     4,
+		PollTimeout: 100 * time.Millisecond,
+	}, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		mu.Lock()
+		defer mu.Unlock()
+		parallel++
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(parallel, count)
+	checkpoint, err = store.ReadCheckpoint("test")
+	assert.Nil(err)
+	parallelCheckpoint, err := store.ReadCheckpoint("parallel")
+	assert.Nil(err)
+	assert.Equal(parallelCheckpoint, checkpoint)
+
+	// Missing name.
+	err = changes.Consume(cdb, changes.ConsumerConfig{}, nil)
+	assert.ErrorMatch(err, ".*consumer needs a name.*")
+}
+
+// TestDispatcher tests processing changes in parallel.
+func TestDispatcher(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	count := 100
+	cdb, _, cleanup := prepareFilledDatabase(assert, "changes-dispatcher", count)
+	defer cleanup()
+
+	// Update some documents multiple times.
+	ids := []string{"dispatched-1", "dispatched-2", "dispatched-3"}
+	for _, id := range ids {
+		doc := MyDocument{DocumentID: id}
+		rs := cdb.CreateDocument(&doc, couchdb.WriteBackIdentity())
+		assert.True(rs.IsOK())
+		for age := 1; age <= 5; age++ {
+			doc.Age = age
+			rs = cdb.UpdateDocument(&doc, couchdb.WriteBackIdentity())
+			assert.True(rs.IsOK())
+		}
+	}
+
+	// Process all changes in parallel.
+	var mu sync.Mutex
+	processed := 0
+	d := changes.NewDispatcher(func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed++
+		return nil
+	}, changes.DispatcherConfig{
+		Workers: 4,
+	})
+	rs := changes.Changes(cdb)
+	assert.True(rs.IsOK())
+	assert.Nil(rs.Do(d.Process))
+	assert.Nil(d.Close())
+	assert.Equal(processed, count+len(ids))
+	assert.Equal(d.Checkpoint(), rs.LastSequence())
+	assert.ErrorMatch(d.Process("x", "y", false, nil, nil), ".*dispatcher is closed.*")
+}
+
+// TestDispatcherOrdering tests the ordering of the changes of
+// each document and the checkpoint of a dispatcher.
+func TestDispatcherOrdering(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	count := 1000
+	var mu sync.Mutex
+	var d *changes.Dispatcher
+	last := map[string]int{}
+	processed := 0
+	block := make(chan struct{})
+	process := func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		seq, err := strconv.Atoi(sequence)
+		assert.Nil(err)
+		if seq == 1 {
+			<-block
+		}
+		// The own sequence isn't acknowledged, so the
+		// checkpoint has to be before.
+		checkpoint, _ := strconv.Atoi(d.Checkpoint())
+		assert.True(checkpoint < seq, fmt.Sprintf("checkpoint %d not before %d", checkpoint, seq))
+		mu.Lock()
+		delay := time.Duration(rnd.Intn(100)) * time.Microsecond
+		mu.Unlock()
+		time.Sleep(delay)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.True(last[id] < seq, fmt.Sprintf("%s: sequence %d after %d", id, seq, last[id]))
+		last[id] = seq
+		processed++
+		return nil
+	}
+	d = changes.NewDispatcher(process, changes.DispatcherConfig{
+		Workers:   8,
+		QueueSize: count,
+	})
+	for seq := 1; seq <= count; seq++ {
+		id := fmt.Sprintf("document-%d", seq%17)
+		rev := fmt.Sprintf("%d-abc", seq/17+1)
+		err := d.Process(id, strconv.Itoa(seq), false, []string{rev}, nil)
+		assert.Nil(err)
+	}
+
+	// The first change blocks the checkpoint.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(d.Checkpoint(), "")
+	close(block)
+	assert.Nil(d.Close())
+	assert.Equal(processed, count)
+	assert.Equal(d.Checkpoint(), strconv.Itoa(count))
+	assert.ErrorMatch(d.Process("document-1", "0", false, nil, nil), ".*dispatcher is closed.*")
+
+	// An error stops the processing, the checkpoint stays
+	// before the failed change.
+	failed := errors.New("failed")
+	d = changes.NewDispatcher(func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+		if sequence == "10" {
+			return failed
+		}
+		return nil
+	}, changes.DispatcherConfig{
+		Workers: 1,
+	})
+	var err error
+	for seq := 1; seq <= 100 && err == nil; seq++ {
+		err = d.Process("document", strconv.Itoa(seq), false, nil, nil)
+	}
+	assert.Equal(d.Close(), failed)
+	assert.Equal(d.Err(), failed)
+	assert.Equal(d.Checkpoint(), "9")
+}
+
 //--------------------
 // HELPERS
 //--------------------
@@ -0,0 +1,310 @@
+// Tideland Go CouchDB Client - Changes - Consumer
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package changes
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Default values of the consumer configuration.
+const (
+	DefaultBatchSize   = 100
+	DefaultPollTimeout = 30 * time.Second
+
+	// CheckpointPrefix is the prefix of the IDs of the local
+	// documents containing the checkpoints.
+	CheckpointPrefix = "changes-consumer-"
+)
+
+//--------------------
+// CHECKPOINT STORE
+//--------------------
+
+// CheckpointStore persists the sequences up to which named
+// consumers have processed the changes.
+type CheckpointStore interface {
+	// ReadCheckpoint returns the sequence of the consumer or
+	// an empty string if it has none.
+	ReadCheckpoint(name string) (string, error)
+
+	// WriteCheckpoint stores the sequence of the consumer.
+	WriteCheckpoint(name, sequence string) error
+}
+
+// localCheckpointStore implements CheckpointStore with
+// local documents of a database.
+type localCheckpointStore struct {
+	mu        sync.Mutex
+	cdb       couchdb.CouchDB
+	revisions map[string]string
+}
+
+// NewLocalCheckpointStore returns a store keeping the checkpoints
+// in local documents of the database. They aren't replicated.
+func NewLocalCheckpointStore(cdb couchdb.CouchDB) CheckpointStore {
+	return &localCheckpointStore{
+		cdb:       cdb,
+		revisions: map[string]string{},
+	}
+}
+
+// ReadCheckpoint implements the CheckpointStore interface.
+func (s *localCheckpointStore) ReadCheckpoint(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoint, err := s.read(name)
+	if err != nil {
+		return "", err
+	}
+	return checkpoint.Sequence, nil
+}
+
+// WriteCheckpoint implements the CheckpointStore interface.
+func (s *localCheckpointStore) WriteCheckpoint(name, sequence string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoint := &couchdbCheckpoint{
+		ID:       couchdb.LocalPrefix + CheckpointPrefix + name,
+		Revision: s.revisions[name],
+		Sequence: sequence,
+	}
+	rs := s.cdb.CreateLocalDocument(checkpoint)
+	if rs.StatusCode() == couchdb.StatusConflict {
+		// Written by another instance, so retry
+		// with the current revision.
+		current, err := s.read(name)
+		if err != nil {
+			return err
+		}
+		checkpoint.Revision = current.Revision
+		rs = s.cdb.CreateLocalDocument(checkpoint)
+	}
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	s.revisions[name] = rs.Revision()
+	return nil
+}
+
+// read reads the checkpoint document of the consumer.
+func (s *localCheckpointStore) read(name string) (*couchdbCheckpoint, error) {
+	checkpoint := &couchdbCheckpoint{}
+	rs := s.cdb.ReadLocalDocument(CheckpointPrefix + name)
+	if rs.StatusCode() == couchdb.StatusNotFound {
+		delete(s.revisions, name)
+		return checkpoint, nil
+	}
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	if err := rs.Document(checkpoint); err != nil {
+		return nil, err
+	}
+	s.revisions[name] = checkpoint.Revision
+	return checkpoint, nil
+}
+
+//--------------------
+// CONSUMER
+//--------------------
+
+// ConsumerConfig configures a consumer of changes.
+type ConsumerConfig struct {
+	// Name identifies the consumer and its checkpoint.
+	Name string
+
+	// Store persists the checkpoint. By default it's stored in
+	// a local document of the database. This one is written
+	// without the context of the consumer, so the last checkpoint
+	// is kept when the context is done.
+	Store CheckpointStore
+
+	// BatchSize is the maximum number of changes processed
+	// before the checkpoint is written.
+	BatchSize int
+
+	// Workers is the number of goroutines processing the changes
+	// with a Dispatcher. With less than two workers the changes
+	// are processed sequentially.
+	Workers int
+
+	// PollTimeout is the time the server waits for new changes
+	// before an empty batch is returned.
+	PollTimeout time.Duration
+
+	// ReconnectDelay is the first delay before retrying after a
+	// network error. It's doubled for each failing retry up to
+	// MaxReconnectDelay.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+}
+
+// Consume processes the changes of the database in batches. It
+// starts after the checkpoint of the named consumer and writes it
+// after each successfully processed batch. So changes are processed
+// at least once, after errors they are processed again. Consume
+// returns if the processor returns an error, in case of a not
+// recoverable error, or with nil when the context is done.
+//
+// With multiple workers the changes are dispatched to them while
+// the next batch is already read. Here the checkpoint is the sequence
+// up to which all changes are processed.
+func Consume(cdb couchdb.CouchDB, cfg ConsumerConfig, process Processor, params ...couchdb.Parameter) error {
+	if cfg.Name == "" {
+		return errors.New(ErrNoConsumerName, errorMessages)
+	}
+	cfg = cfg.withDefaults(cdb)
+	since, err := cfg.Store.ReadCheckpoint(cfg.Name)
+	if err != nil {
+		return errors.Annotate(err, ErrCheckpoint, errorMessages, cfg.Name)
+	}
+	checkpoint := since
+	ctx := cdb.Context()
+	if cfg.Workers < 2 {
+		return consumeBatches(cdb, cfg, since, process, params, func(last string) error {
+			return writeCheckpoint(ctx, cfg, &checkpoint, last)
+		})
+	}
+	d := NewDispatcher(process, DispatcherConfig{
+		Workers: cfg.Workers,
+	})
+	err = consumeBatches(cdb, cfg, since, d.Process, params, func(last string) error {
+		return writeCheckpoint(ctx, cfg, &checkpoint, d.Checkpoint())
+	})
+	if closeErr := d.Close(); closeErr != nil {
+		return closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return writeCheckpoint(ctx, cfg, &checkpoint, d.Checkpoint())
+}
+
+// ConsumeContext processes the changes of the database in
+// batches like Consume() using the passed context.
+func ConsumeContext(ctx context.Context, cdb couchdb.CouchDB, cfg ConsumerConfig, process Processor, params ...couchdb.Parameter) error {
+	return Consume(cdb.WithContext(ctx), cfg, process, params...)
+}
+
+// consumeBatches reads the batches of changes, passes them to
+// the processor, and calls commit with the last sequence of each
+// processed batch.
+func consumeBatches(cdb couchdb.CouchDB, cfg ConsumerConfig, since string, process Processor, params []couchdb.Parameter, commit func(last string) error) error {
+	ctx := cdb.Context()
+	delay := cfg.ReconnectDelay
+	for {
+		batchParams := append(params[:len(params):len(params)], couchdb.Streaming(), Limit(cfg.BatchSize), cfg.pollParameter(since))
+		rs := Changes(cdb, batchParams...)
+		if !rs.IsOK() {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if reqErr, ok := couchdb.AsRequestError(rs.Error()); ok {
+				if reqErr.StatusCode < 500 && reqErr.StatusCode != couchdb.StatusTooManyRequests {
+					return rs.Error()
+				}
+			}
+			if !sleep(ctx, delay) {
+				return nil
+			}
+			delay *= 2
+			if delay > cfg.MaxReconnectDelay {
+				delay = cfg.MaxReconnectDelay
+			}
+			continue
+		}
+		delay = cfg.ReconnectDelay
+		if err := rs.Do(process); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if last := rs.LastSequence(); last != "" {
+			since = last
+		}
+		if err := commit(since); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// writeCheckpoint writes the sequence as checkpoint if it
+// differs from the current one. A failing write after the
+// context is done is a clean stop.
+func writeCheckpoint(ctx context.Context, cfg ConsumerConfig, current *string, sequence string) error {
+	if sequence == "" || sequence == *current {
+		return nil
+	}
+	if err := cfg.Store.WriteCheckpoint(cfg.Name, sequence); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return errors.Annotate(err, ErrCheckpoint, errorMessages, cfg.Name)
+	}
+	*current = sequence
+	return nil
+}
+
+// withDefaults returns the configuration with the
+// default values for the unset fields.
+func (cfg ConsumerConfig) withDefaults(cdb couchdb.CouchDB) ConsumerConfig {
+	if cfg.Store == nil {
+		// Checkpoints of processed changes are also written
+		// when the context is done.
+		cdb = cdb.WithContext(context.WithoutCancel(cdb.Context()))
+		cfg.Store = NewLocalCheckpointStore(cdb)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.PollTimeout <= 0 {
+		cfg.PollTimeout = DefaultPollTimeout
+	}
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = DefaultReconnectDelay
+	}
+	if cfg.MaxReconnectDelay <= 0 {
+		cfg.MaxReconnectDelay = DefaultMaxReconnectDelay
+	}
+	if cfg.MaxReconnectDelay < cfg.ReconnectDelay {
+		cfg.MaxReconnectDelay = cfg.ReconnectDelay
+	}
+	return cfg
+}
+
+// pollParameter lets a request wait for changes after
+// the sequence.
+func (cfg ConsumerConfig) pollParameter(since string) couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("feed", FeedLongpoll)
+		Timeout(cfg.PollTimeout)(pa)
+		if since != "" {
+			pa.SetQuery("since", since)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,219 @@
+// Tideland Go CouchDB Client - Changes - Dispatcher
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package changes
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Default values of the dispatcher configuration.
+const (
+	DefaultWorkers   = 4
+	DefaultQueueSize = 16
+)
+
+//--------------------
+// DISPATCHER
+//--------------------
+
+// DispatcherConfig configures a dispatcher.
+type DispatcherConfig struct {
+	// Workers is the number of goroutines processing
+	// the changes.
+	Workers int
+
+	// QueueSize is the number of changes buffered per worker
+	// before dispatching blocks.
+	QueueSize int
+}
+
+// withDefaults returns the configuration with the
+// default values for the unset fields.
+func (cfg DispatcherConfig) withDefaults() DispatcherConfig {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	return cfg
+}
+
+// dispatchedChange is a change queued for a worker.
+type dispatchedChange struct {
+	index  int
+	change Change
+}
+
+// pendingChange is a dispatched change waiting for
+// its acknowledgement.
+type pendingChange struct {
+	sequence string
+	done     bool
+}
+
+// Dispatcher processes changes concurrently with a pool of workers.
+// The changes are distributed by their document ID, so the changes
+// of one document are processed in order by the same worker. The
+// checkpoint only advances to a sequence when all changes up to it
+// are processed.
+type Dispatcher struct {
+	process    Processor
+	queues     []chan dispatchedChange
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	closed     bool
+	err        error
+	offset     int
+	pending    []pendingChange
+	checkpoint string
+}
+
+// NewDispatcher starts a dispatcher using the processor in
+// its workers.
+func NewDispatcher(process Processor, cfg DispatcherConfig) *Dispatcher {
+	cfg = cfg.withDefaults()
+	d := &Dispatcher{
+		process: process,
+		queues:  make([]chan dispatchedChange, cfg.Workers),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan dispatchedChange, cfg.QueueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// Process dispatches a change to the worker of its document. It
+// is a Processor, so it can be passed to ResultSet.Do(), FeedDo(),
+// or Consume(). It must not be called concurrently. After a
+// failed processing it returns the error of the processor.
+func (d *Dispatcher) Process(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return errors.New(ErrDispatchClosed, errorMessages)
+	}
+	if d.err != nil {
+		err := d.err
+		d.mu.Unlock()
+		return err
+	}
+	index := d.offset + len(d.pending)
+	d.pending = append(d.pending, pendingChange{
+		sequence: sequence,
+	})
+	d.mu.Unlock()
+	d.queues[d.worker(id)] <- dispatchedChange{
+		index: index,
+		change: Change{
+			ID:        id,
+			Sequence:  sequence,
+			Deleted:   deleted,
+			Revisions: revisions,
+			Document:  document,
+		},
+	}
+	return nil
+}
+
+// Checkpoint returns the sequence up to which all dispatched
+// changes are processed.
+func (d *Dispatcher) Checkpoint() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.checkpoint
+}
+
+// Err returns the first error returned by the processor.
+func (d *Dispatcher) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Close waits until the dispatched changes are processed, stops
+// the workers, and returns the first error of the processor.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return d.Err()
+	}
+	d.closed = true
+	d.mu.Unlock()
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+	return d.Err()
+}
+
+// worker returns the index of the worker for the document.
+func (d *Dispatcher) worker(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// work processes the changes of one queue. After an error
+// the remaining changes are skipped.
+func (d *Dispatcher) work(queue <-chan dispatchedChange) {
+	defer d.wg.Done()
+	for dc := range queue {
+		if d.Err() != nil {
+			continue
+		}
+		c := dc.change
+		if err := d.process(c.ID, c.Sequence, c.Deleted, c.Revisions, c.Document); err != nil {
+			d.fail(err)
+			continue
+		}
+		d.acknowledge(dc.index)
+	}
+}
+
+// acknowledge marks the change as processed and advances the
+// checkpoint over all leading processed changes.
+func (d *Dispatcher) acknowledge(index int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[index-d.offset].done = true
+	n := 0
+	for n < len(d.pending) && d.pending[n].done {
+		d.checkpoint = d.pending[n].sequence
+		n++
+	}
+	d.pending = d.pending[n:]
+	d.offset += n
+}
+
+// fail keeps the first error of the processor.
+func (d *Dispatcher) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// EOF
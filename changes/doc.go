@@ -7,6 +7,63 @@
 
 // Package changes of the Tideland Go CouchDB Client helps to
 // access the stream of changes inside a CouchDB.
+//
+// Changes() performs a single request returning the changes since
+// a sequence. Parameters filter them by document IDs, selectors,
+// views, or filter functions of design documents and let them
+// include the documents with their conflicts and attachments.
+//
+//     rs := changes.Changes(cdb,
+//         changes.FilterFunction("app", "important", couchdb.KeyValue{Key: "level", Value: "3"}),
+//         changes.IncludeDocuments(),
+//         changes.Conflicts(),
+//     )
+//     cs, err := rs.Changes()
+//
+// Sequences are opaque strings, also when CouchDB returns numbers. A Feed instead delivers the changes continuously over
+// a channel. It streams them in the continuous mode or polls them
+// in the longpoll mode. After network errors it reconnects starting
+// after the last delivered sequence.
+//
+//     feed := changes.NewFeedContext(ctx, cdb, changes.FeedConfig{
+//         Heartbeat: 10 * time.Second,
+//     }, changes.FilterDocumentIDs("a", "b"))
+//     for change := range feed.Changes() {
+//         ...
+//     }
+//     err := feed.Err()
+//
+// FeedDo() processes the changes with a function instead. Both stop
+// when their context is cancelled. A timeout configured for the
+// database connection only limits connecting and waiting for the
+// response headers of feeds.
+//
+// Consume() processes the changes in batches and stores the sequence
+// of each completely processed batch as checkpoint under the name of
+// the consumer. A restarted consumer resumes after its checkpoint, so
+// changes are delivered at least once. By default the checkpoints are
+// local documents in the database, own stores implement the interface
+// CheckpointStore.
+//
+//     err := changes.ConsumeContext(ctx, cdb, changes.ConsumerConfig{
+//         Name: "indexer",
+//     }, func(id, sequence string, deleted bool, revisions []string, document couchdb.Unmarshable) error {
+//         ...
+//     })
+//
+// A Dispatcher processes changes concurrently. It distributes them to
+// its workers by document ID, so the changes of one document keep their
+// order. Its checkpoint is the sequence up to which all changes are
+// processed. Consumers use a dispatcher if more than one worker is
+// configured.
+//
+//     d := changes.NewDispatcher(process, changes.DispatcherConfig{
+//         Workers: 8,
+//     })
+//     err := changes.FeedDoContext(ctx, cdb, changes.FeedConfig{}, d.Process)
+//     ...
+//     err = d.Close()
+//     checkpoint := d.Checkpoint()
 package changes
 
 // EOF
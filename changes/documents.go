@@ -13,6 +13,10 @@ package changes
 
 import (
 	"encoding/json"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
 )
 
 //--------------------
@@ -23,15 +27,16 @@ import (
 // INTERNAL DOCUMENT TYPES
 //--------------------
 
-// couchdbDocumentIDs contains document identifiers as body
-// for the according changes filter.
-type couchdbDocumentIDs struct {
-	DocumentIDs []string `json:"doc_ids"`
+// couchdbFilter contains document identifiers and a selector
+// as body for the according changes filters.
+type couchdbFilter struct {
+	DocumentIDs []string       `json:"doc_ids,omitempty"`
+	Selector    json.Marshaler `json:"selector,omitempty"`
 }
 
 // couchdbChanges is a generic result of a CouchDB changes feed.
 type couchdbChanges struct {
-	LastSequence interface{}           `json:"last_seq"`
+	LastSequence couchdb.Sequence      `json:"last_seq"`
 	Pending      int                   `json:"pending"`
 	Results      couchdbChangesResults `json:"results"`
 }
@@ -39,12 +44,24 @@ type couchdbChanges struct {
 // couchdbChangesResult contains one result of a changes feed.
 type couchdbChangesResult struct {
 	ID       string                      `json:"id"`
-	Sequence interface{}                 `json:"seq"`
+	Sequence couchdb.Sequence            `json:"seq"`
 	Changes  couchdbChangesResultChanges `json:"changes"`
 	Document json.RawMessage             `json:"doc,omitempty"`
 	Deleted  bool                        `json:"deleted,omitempty"`
 }
 
+// conflicts returns the conflicts of the included document.
+func (r couchdbChangesResult) conflicts() ([]string, error) {
+	if len(r.Document) == 0 {
+		return nil, nil
+	}
+	doc := couchdbDocumentConflicts{}
+	if err := json.Unmarshal(r.Document, &doc); err != nil {
+		return nil, errors.Annotate(err, ErrDecodingFeed, errorMessages)
+	}
+	return doc.Conflicts, nil
+}
+
 type couchdbChangesResults []couchdbChangesResult
 
 // couchdbChangesResultChange contains the revision number of one
@@ -55,4 +72,33 @@ type couchdbChangesResultChange struct {
 
 type couchdbChangesResultChanges []couchdbChangesResultChange
 
+// revisions returns the revisions of the changes.
+func (rcs couchdbChangesResultChanges) revisions() []string {
+	revisions := []string{}
+	for _, rc := range rcs {
+		revisions = append(revisions, rc.Revision)
+	}
+	return revisions
+}
+
+// couchdbDocumentConflicts contains the conflicts of
+// a document included in a change.
+type couchdbDocumentConflicts struct {
+	Conflicts []string `json:"_conflicts,omitempty"`
+}
+
+// couchdbCheckpoint contains the checkpoint of a consumer.
+type couchdbCheckpoint struct {
+	ID       string `json:"_id"`
+	Revision string `json:"_rev,omitempty"`
+	Sequence string `json:"sequence"`
+}
+
+// couchdbFeedLine contains one line of a continuous feed. It's
+// a change or the last sequence when the server closes the feed.
+type couchdbFeedLine struct {
+	couchdbChangesResult
+	LastSequence couchdb.Sequence `json:"last_seq"`
+}
+
 // EOF
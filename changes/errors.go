@@ -0,0 +1,43 @@
+// Tideland Go CouchDB Client - Changes - Errors
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package changes
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes of the package.
+const (
+	ErrDecodingFeed = iota + 1
+	ErrFeedInterrupted
+	ErrInvalidFeedMode
+	ErrNoConsumerName
+	ErrCheckpoint
+	ErrDispatchClosed
+)
+
+// errorMessages contains the messages for the
+// individual error codes.
+var errorMessages = errors.Messages{
+	ErrDecodingFeed:    "cannot decode changes feed",
+	ErrFeedInterrupted: "changes feed interrupted",
+	ErrInvalidFeedMode: "invalid feed mode '%s'",
+	ErrNoConsumerName:  "consumer needs a name",
+	ErrCheckpoint:      "cannot access checkpoint of consumer '%s'",
+	ErrDispatchClosed:  "dispatcher is closed",
+}
+
+// EOF
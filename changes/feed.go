@@ -0,0 +1,434 @@
+// Tideland Go CouchDB Client - Changes - Feed
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package changes
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Modes of a feed.
+const (
+	FeedContinuous = "continuous"
+	FeedLongpoll   = "longpoll"
+)
+
+// Default values of the feed configuration.
+const (
+	DefaultHeartbeat         = 10 * time.Second
+	DefaultReconnectDelay    = time.Second
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
+
+//--------------------
+// FEED CONFIGURATION
+//--------------------
+
+// FeedConfig configures a feed. Zero values are replaced by
+// the defaults.
+type FeedConfig struct {
+	// Mode is FeedContinuous or FeedLongpoll. A continuous feed
+	// falls back to longpoll if the server rejects it.
+	Mode string
+
+	// Since is the sequence to start after, e.g. SinceNow.
+	// Otherwise the parameter Since() is used for the first
+	// connection.
+	Since string
+
+	// Heartbeat lets the server send empty lines in this interval.
+	// If nothing arrives for twice the interval the feed reconnects.
+	Heartbeat time.Duration
+
+	// Timeout lets the server close the connection if no changes
+	// happen in this time. It is only used without heartbeat. The
+	// feed then reconnects.
+	Timeout time.Duration
+
+	// ReconnectDelay is the first delay before reconnecting after
+	// an error. It's doubled for each failing reconnect up to
+	// MaxReconnectDelay.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+
+	// Buffer is the size of the buffer of the changes channel.
+	Buffer int
+}
+
+// withDefaults returns the configuration with the
+// default values for the unset fields.
+func (cfg FeedConfig) withDefaults() FeedConfig {
+	if cfg.Mode == "" {
+		cfg.Mode = FeedContinuous
+	}
+	if cfg.Heartbeat == 0 && cfg.Timeout == 0 {
+		cfg.Heartbeat = DefaultHeartbeat
+	}
+	if cfg.ReconnectDelay == 0 {
+		cfg.ReconnectDelay = DefaultReconnectDelay
+	}
+	if cfg.MaxReconnectDelay == 0 {
+		cfg.MaxReconnectDelay = DefaultMaxReconnectDelay
+	}
+	if cfg.MaxReconnectDelay < cfg.ReconnectDelay {
+		cfg.MaxReconnectDelay = cfg.ReconnectDelay
+	}
+	return cfg
+}
+
+//--------------------
+// FEED
+//--------------------
+
+// Change contains one change delivered by a feed. Conflicts
+// are only set if the document is included and the parameter
+// Conflicts() is used.
+type Change struct {
+	ID        string
+	Sequence  string
+	Deleted   bool
+	Revisions []string
+	Conflicts []string
+	Document  couchdb.Unmarshable
+}
+
+// Feed delivers the changes of a database continuously over a
+// channel. After network errors it reconnects starting at the
+// last delivered sequence. The feed stops when its context is
+// cancelled or Stop() is called.
+type Feed struct {
+	cdb     couchdb.CouchDB
+	cfg     FeedConfig
+	params  []couchdb.Parameter
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changes chan Change
+	done    chan struct{}
+
+	mu    sync.Mutex
+	since string
+	err   error
+}
+
+// NewFeed starts a feed of the changes of the database. The
+// parameters of the package like filters can be passed.
+func NewFeed(cdb couchdb.CouchDB, cfg FeedConfig, params ...couchdb.Parameter) *Feed {
+	f := newFeed(cdb, cfg, params...)
+	f.changes = make(chan Change, f.cfg.Buffer)
+	go func() {
+		defer close(f.done)
+		defer close(f.changes)
+		err := f.run(func(change Change) error {
+			select {
+			case f.changes <- change:
+				return nil
+			case <-f.ctx.Done():
+				return f.ctx.Err()
+			}
+		})
+		f.mu.Lock()
+		f.err = err
+		f.mu.Unlock()
+	}()
+	return f
+}
+
+// NewFeedContext starts a feed of the changes of the database
+// using the passed context.
+func NewFeedContext(ctx context.Context, cdb couchdb.CouchDB, cfg FeedConfig, params ...couchdb.Parameter) *Feed {
+	return NewFeed(cdb.WithContext(ctx), cfg, params...)
+}
+
+// FeedDo processes the changes of the database continuously like
+// a feed. It returns if the processor returns an error, in case of
+// a not recoverable error, or with nil when the context is done.
+func FeedDo(cdb couchdb.CouchDB, cfg FeedConfig, process Processor, params ...couchdb.Parameter) error {
+	f := newFeed(cdb, cfg, params...)
+	defer f.cancel()
+	return f.run(func(change Change) error {
+		return process(change.ID, change.Sequence, change.Deleted, change.Revisions, change.Document)
+	})
+}
+
+// FeedDoContext processes the changes of the database continuously
+// like a feed using the passed context.
+func FeedDoContext(ctx context.Context, cdb couchdb.CouchDB, cfg FeedConfig, process Processor, params ...couchdb.Parameter) error {
+	return FeedDo(cdb.WithContext(ctx), cfg, process, params...)
+}
+
+// newFeed creates a feed without starting it.
+func newFeed(cdb couchdb.CouchDB, cfg FeedConfig, params ...couchdb.Parameter) *Feed {
+	ctx, cancel := context.WithCancel(cdb.Context())
+	cfg = cfg.withDefaults()
+	return &Feed{
+		cdb:    cdb.WithContext(ctx),
+		cfg:    cfg,
+		params: params,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		since:  cfg.Since,
+	}
+}
+
+// Changes returns the channel delivering the changes. It is
+// closed when the feed stops.
+func (f *Feed) Changes() <-chan Change {
+	return f.changes
+}
+
+// LastSequence returns the sequence of the last delivered
+// change. Feeds can be restarted with it.
+func (f *Feed) LastSequence() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.since
+}
+
+// Err returns the error which stopped the feed. It is nil as
+// long as the feed is running or when it has been stopped by
+// its context.
+func (f *Feed) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Stop stops the feed and waits until it is done.
+func (f *Feed) Stop() error {
+	f.cancel()
+	<-f.done
+	return f.Err()
+}
+
+// run connects to the changes feed and delivers the changes
+// until the context is done or a not recoverable error happens.
+func (f *Feed) run(deliver func(change Change) error) error {
+	if f.cfg.Mode != FeedContinuous && f.cfg.Mode != FeedLongpoll {
+		return errors.New(ErrInvalidFeedMode, errorMessages, f.cfg.Mode)
+	}
+	mode := f.cfg.Mode
+	delay := f.cfg.ReconnectDelay
+	for {
+		received, err := f.connect(mode, deliver)
+		if f.ctx.Err() != nil {
+			return nil
+		}
+		if perr, ok := err.(*processError); ok {
+			return perr.err
+		}
+		if err == nil {
+			delay = f.cfg.ReconnectDelay
+			continue
+		}
+		if reqErr, ok := couchdb.AsRequestError(err); ok {
+			switch {
+			case mode == FeedContinuous && reqErr.StatusCode == couchdb.StatusBadRequest:
+				mode = FeedLongpoll
+				continue
+			case reqErr.StatusCode < 500 && reqErr.StatusCode != couchdb.StatusTooManyRequests:
+				return err
+			}
+		}
+		if received {
+			delay = f.cfg.ReconnectDelay
+		}
+		if !sleep(f.ctx, delay) {
+			return nil
+		}
+		delay *= 2
+		if delay > f.cfg.MaxReconnectDelay {
+			delay = f.cfg.MaxReconnectDelay
+		}
+	}
+}
+
+// connect performs one request of the feed and delivers its
+// changes. It returns if changes have been received.
+func (f *Feed) connect(mode string, deliver func(change Change) error) (bool, error) {
+	ctx, cancel := context.WithCancel(f.ctx)
+	defer cancel()
+	params := append(f.params[:len(f.params):len(f.params)], couchdb.Streaming(), f.feedParameter(mode))
+	rs := f.cdb.WithContext(ctx).GetOrPost(f.cdb.DatabasePath("_changes"), nil, params...)
+	if !rs.IsOK() {
+		return false, rs.Error()
+	}
+	stream, err := rs.Stream()
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+	var r io.Reader = stream
+	if f.cfg.Heartbeat > 0 {
+		w := newWatchdog(stream, 2*f.cfg.Heartbeat, cancel)
+		defer w.stop()
+		r = w
+	}
+	if mode == FeedLongpoll {
+		return f.deliverLongpoll(r, deliver)
+	}
+	return f.deliverContinuous(r, deliver)
+}
+
+// deliverContinuous decodes and delivers the newline delimited
+// changes of a continuous feed.
+func (f *Feed) deliverContinuous(r io.Reader, deliver func(change Change) error) (bool, error) {
+	decoder := json.NewDecoder(r)
+	received := false
+	for {
+		line := couchdbFeedLine{}
+		if err := decoder.Decode(&line); err != nil {
+			if err == io.EOF {
+				return received, errors.New(ErrFeedInterrupted, errorMessages)
+			}
+			return received, errors.Annotate(err, ErrDecodingFeed, errorMessages)
+		}
+		if line.ID == "" && line.LastSequence != "" {
+			f.setSince(string(line.LastSequence))
+			return received, nil
+		}
+		received = true
+		if err := f.deliver(line.couchdbChangesResult, deliver); err != nil {
+			return received, err
+		}
+	}
+}
+
+// deliverLongpoll decodes and delivers the changes of a
+// longpoll request.
+func (f *Feed) deliverLongpoll(r io.Reader, deliver func(change Change) error) (bool, error) {
+	changes := couchdbChanges{}
+	if err := json.NewDecoder(r).Decode(&changes); err != nil {
+		return false, errors.Annotate(err, ErrDecodingFeed, errorMessages)
+	}
+	for _, result := range changes.Results {
+		if err := f.deliver(result, deliver); err != nil {
+			return true, err
+		}
+	}
+	f.setSince(string(changes.LastSequence))
+	return len(changes.Results) > 0, nil
+}
+
+// deliver passes the change to the deliver function and
+// remembers its sequence.
+func (f *Feed) deliver(result couchdbChangesResult, deliver func(change Change) error) error {
+	change, err := newChange(result)
+	if err != nil {
+		return err
+	}
+	if err := deliver(change); err != nil {
+		return &processError{err}
+	}
+	f.setSince(change.Sequence)
+	return nil
+}
+
+// feedParameter sets the feed mode, heartbeat or timeout,
+// and the sequence to start after.
+func (f *Feed) feedParameter(mode string) couchdb.Parameter {
+	since := f.LastSequence()
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("feed", mode)
+		if f.cfg.Heartbeat > 0 {
+			Heartbeat(f.cfg.Heartbeat)(pa)
+		} else {
+			Timeout(f.cfg.Timeout)(pa)
+		}
+		if since != "" {
+			pa.SetQuery("since", since)
+		}
+	}
+}
+
+// setSince sets the sequence to start after. Empty sequences,
+// e.g. when using SequenceInterval(), are ignored.
+func (f *Feed) setSince(since string) {
+	if since == "" {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.since = since
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// processError marks errors returned by the processing
+// of a change.
+type processError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (pe *processError) Error() string {
+	return pe.err.Error()
+}
+
+// watchdog cancels a connection if a read waits longer than
+// the given time for data. It is only armed while reading, so
+// slow processing of the changes doesn't cancel the connection.
+type watchdog struct {
+	reader  io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newWatchdog creates a watchdog reading from r.
+func newWatchdog(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *watchdog {
+	w := &watchdog{
+		reader:  r,
+		timeout: timeout,
+		timer:   time.AfterFunc(timeout, cancel),
+	}
+	w.timer.Stop()
+	return w
+}
+
+// Read implements the io.Reader interface.
+func (w *watchdog) Read(p []byte) (int, error) {
+	w.timer.Reset(w.timeout)
+	defer w.timer.Stop()
+	return w.reader.Read(p)
+}
+
+// stop stops the watchdog.
+func (w *watchdog) stop() {
+	w.timer.Stop()
+}
+
+// sleep waits for the delay or until the context is done.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// EOF
@@ -12,10 +12,11 @@ package changes
 //--------------------
 
 import (
-	"encoding/json"
 	"strconv"
+	"time"
 
 	"github.com/tideland/gocouch/couchdb"
+	"github.com/tideland/gocouch/find"
 )
 
 //--------------------
@@ -70,12 +71,12 @@ func Style(style string) couchdb.Parameter {
 func FilterDocumentIDs(documentIDs ...string) couchdb.Parameter {
 	update := func(doc interface{}) interface{} {
 		if doc == nil {
-			doc = &couchdbDocumentIDs{}
+			doc = &couchdbFilter{}
 		}
-		idsdoc, ok := doc.(*couchdbDocumentIDs)
+		filter, ok := doc.(*couchdbFilter)
 		if ok {
-			idsdoc.DocumentIDs = append(idsdoc.DocumentIDs, documentIDs...)
-			return idsdoc
+			filter.DocumentIDs = append(filter.DocumentIDs, documentIDs...)
+			return filter
 		}
 		return doc
 	}
@@ -85,10 +86,18 @@ func FilterDocumentIDs(documentIDs ...string) couchdb.Parameter {
 	}
 }
 
-// FilterSelector sets the filter to the passed selector expression.
-func FilterSelector(selector json.RawMessage) couchdb.Parameter {
+// FilterSelector sets the filter to the passed selector. It can be
+// created with find.Select() or be raw JSON like json.RawMessage.
+func FilterSelector(selector find.Selector) couchdb.Parameter {
 	update := func(doc interface{}) interface{} {
-		// TODO 2017-04-09 Mue Set selector expression.
+		if doc == nil {
+			doc = &couchdbFilter{}
+		}
+		filter, ok := doc.(*couchdbFilter)
+		if ok {
+			filter.Selector = selector
+			return filter
+		}
 		return doc
 	}
 	return func(pa couchdb.Parameterizable) {
@@ -97,6 +106,18 @@ func FilterSelector(selector json.RawMessage) couchdb.Parameter {
 	}
 }
 
+// FilterFunction sets the filter function with the given name
+// of the design document. The key/values are passed as query
+// parameters to the function.
+func FilterFunction(designID, name string, kvs ...couchdb.KeyValue) couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("filter", designID+"/"+name)
+		for _, kv := range kvs {
+			pa.SetQuery(kv.Key, kv.Value)
+		}
+	}
+}
+
 // FilterView sets the name of a view which map function acts as
 // filter in case it emits at least one record.
 func FilterView(view string) couchdb.Parameter {
@@ -106,4 +127,69 @@ func FilterView(view string) couchdb.Parameter {
 	}
 }
 
+// IncludeDocuments sets the flag for the including of the
+// changed documents.
+func IncludeDocuments() couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("include_docs", "true")
+	}
+}
+
+// Conflicts lets included documents contain their conflicting
+// revisions. They are returned as Conflicts of a Change.
+func Conflicts() couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("conflicts", "true")
+	}
+}
+
+// Attachments lets included documents contain the Base64
+// encoded content of their attachments.
+func Attachments() couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("attachments", "true")
+	}
+}
+
+// AttachmentEncodingInfo lets included documents contain the
+// encoding information of compressed attachments.
+func AttachmentEncodingInfo() couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("att_encoding_info", "true")
+	}
+}
+
+// SequenceInterval lets the server only calculate the sequence
+// of every nth change. The others return an empty sequence. It
+// speeds up the feed on clusters.
+func SequenceInterval(interval int) couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("seq_interval", strconv.Itoa(interval))
+	}
+}
+
+// Heartbeat lets the server send an empty line in the given
+// interval to keep longpoll and continuous feeds alive.
+func Heartbeat(heartbeat time.Duration) couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("heartbeat", strconv.FormatInt(int64(heartbeat/time.Millisecond), 10))
+	}
+}
+
+// Timeout sets the maximum time the server waits for changes
+// in longpoll and continuous feeds.
+func Timeout(timeout time.Duration) couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("timeout", strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+	}
+}
+
+// LastEventID sets the sequence after which an event source
+// feed continues. It's an alias of Since().
+func LastEventID(sequence string) couchdb.Parameter {
+	return func(pa couchdb.Parameterizable) {
+		pa.SetQuery("last-event-id", sequence)
+	}
+}
+
 // EOF
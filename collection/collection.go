@@ -0,0 +1,316 @@
+// Tideland Go CouchDB Client - Collection
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package collection
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
+	"github.com/tideland/gocouch/find"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// Option configures a collection.
+type Option func(o *options)
+
+// options contains the configuration of a collection.
+type options struct {
+	field string
+	value string
+}
+
+// Discriminator binds the collection to the documents having
+// the value in the given field. It is set when writing and
+// checked when reading documents.
+func Discriminator(field, value string) Option {
+	return func(o *options) {
+		o.field = field
+		o.value = value
+	}
+}
+
+// TypeField binds the collection to the documents having
+// the value in the field "type".
+func TypeField(value string) Option {
+	return Discriminator("type", value)
+}
+
+//--------------------
+// COLLECTION
+//--------------------
+
+// Collection provides typed access to the documents of type T.
+// T has to be marshallable to a JSON object, typically it is a
+// struct with the fields _id and _rev.
+type Collection[T any] struct {
+	cdb     couchdb.CouchDB
+	options options
+}
+
+// New creates a collection of the documents of type T
+// stored in the database.
+func New[T any](cdb couchdb.CouchDB, opts ...Option) *Collection[T] {
+	c := &Collection[T]{
+		cdb: cdb,
+	}
+	for _, opt := range opts {
+		opt(&c.options)
+	}
+	return c
+}
+
+// WithContext returns a collection performing its
+// requests with the given context.
+func (c *Collection[T]) WithContext(ctx context.Context) *Collection[T] {
+	return &Collection[T]{
+		cdb:     c.cdb.WithContext(ctx),
+		options: c.options,
+	}
+}
+
+// Database returns the database of the collection.
+func (c *Collection[T]) Database() couchdb.CouchDB {
+	return c.cdb
+}
+
+// Get reads the document with the given ID. Documents with
+// another discriminator return an error.
+func (c *Collection[T]) Get(id string, params ...couchdb.Parameter) (T, error) {
+	var doc T
+	rs := c.cdb.ReadDocument(id, params...)
+	if !rs.IsOK() {
+		return doc, rs.Error()
+	}
+	raw, err := rs.Raw()
+	if err != nil {
+		return doc, err
+	}
+	doc, ok, err := c.decode(couchdb.NewUnmarshableRaw(raw), true)
+	if err != nil {
+		return doc, err
+	}
+	if !ok {
+		return doc, errors.New(ErrTypeMismatch, errorMessages, id, c.options.value)
+	}
+	return doc, nil
+}
+
+// GetMany reads the documents with the given IDs in one request.
+// Missing and deleted documents as well as those with another
+// discriminator are skipped.
+func (c *Collection[T]) GetMany(ids []string, params ...couchdb.Parameter) ([]T, error) {
+	results, err := c.cdb.BulkReadDocuments(couchdb.ReferencesTo(ids...), params...)
+	if err != nil {
+		return nil, err
+	}
+	docs := []T{}
+	for _, result := range results {
+		if result.Error != "" {
+			return nil, errors.New(ErrReadingDocument, errorMessages, result.ID, result.Reason)
+		}
+		if !result.IsFound() {
+			continue
+		}
+		doc, ok, err := c.decode(result.Document, true)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// Create creates a new document. Its ID and revision are
+// set afterwards.
+func (c *Collection[T]) Create(doc *T, params ...couchdb.Parameter) error {
+	fields, err := c.encode(doc)
+	if err != nil {
+		return err
+	}
+	return c.written(doc, c.cdb.CreateDocument(fields, params...))
+}
+
+// Update updates an existing document. Its new revision
+// is set afterwards.
+func (c *Collection[T]) Update(doc *T, params ...couchdb.Parameter) error {
+	fields, err := c.encode(doc)
+	if err != nil {
+		return err
+	}
+	return c.written(doc, c.cdb.UpdateDocument(fields, params...))
+}
+
+// Delete deletes an existing document. The revision of the
+// deletion is set afterwards.
+func (c *Collection[T]) Delete(doc *T, params ...couchdb.Parameter) error {
+	fields, err := c.encode(doc)
+	if err != nil {
+		return err
+	}
+	return c.written(doc, c.cdb.DeleteDocument(fields, params...))
+}
+
+// Find returns the documents matching the selector. In case
+// of a discriminator it is added to the selector.
+func (c *Collection[T]) Find(selector find.Selector, params ...find.Parameter) ([]T, error) {
+	docs := []T{}
+	for doc, err := range c.FindSeq(selector, params...) {
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// FindSeq returns an iterator over the documents matching the
+// selector. Together with find.Streaming() the documents are
+// decoded while they arrive.
+func (c *Collection[T]) FindSeq(selector find.Selector, params ...find.Parameter) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		frs := find.Find(c.cdb, c.selector(selector), params...)
+		defer frs.Close()
+		if !frs.IsOK() {
+			yield(zero, frs.Error())
+			return
+		}
+		err := frs.Do(func(document couchdb.Unmarshable) error {
+			doc, _, err := c.decode(document, false)
+			if err != nil {
+				return err
+			}
+			if !yield(doc, nil) {
+				return stopped{}
+			}
+			return nil
+		})
+		if _, ok := err.(stopped); err != nil && !ok {
+			yield(zero, err)
+		}
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// stopped signals the stopping of an iteration by the caller.
+type stopped struct{}
+
+// Error implements the error interface.
+func (stopped) Error() string {
+	return "iteration stopped"
+}
+
+// encode returns the document as map containing the discriminator.
+// Empty IDs and revisions are removed.
+func (c *Collection[T]) encode(doc *T) (map[string]interface{}, error) {
+	marshalled, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrEncodingDocument, errorMessages)
+	}
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(marshalled, &fields); err != nil {
+		return nil, errors.Annotate(err, ErrEncodingDocument, errorMessages)
+	}
+	for _, key := range []string{"_id", "_rev"} {
+		if fields[key] == "" {
+			delete(fields, key)
+		}
+	}
+	if c.options.field != "" {
+		fields[c.options.field] = c.options.value
+	}
+	return fields, nil
+}
+
+// written sets ID and revision of a successful write in the document.
+func (c *Collection[T]) written(doc *T, rs couchdb.ResultSet) error {
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	identity, err := json.Marshal(couchdb.DocumentBase{
+		ID:       rs.ID(),
+		Revision: rs.Revision(),
+	})
+	if err != nil {
+		return errors.Annotate(err, ErrDecodingDocument, errorMessages)
+	}
+	if err = json.Unmarshal(identity, doc); err != nil {
+		return errors.Annotate(err, ErrDecodingDocument, errorMessages)
+	}
+	return nil
+}
+
+// decode unmarshals the document. If wanted it checks the
+// discriminator and returns false if it doesn't match.
+func (c *Collection[T]) decode(document couchdb.Unmarshable, check bool) (T, bool, error) {
+	var doc T
+	if check && c.options.field != "" {
+		fields := map[string]json.RawMessage{}
+		if err := document.Unmarshal(&fields); err != nil {
+			return doc, false, errors.Annotate(err, ErrDecodingDocument, errorMessages)
+		}
+		var value string
+		if err := json.Unmarshal(fields[c.options.field], &value); err != nil || value != c.options.value {
+			return doc, false, nil
+		}
+	}
+	if err := document.Unmarshal(&doc); err != nil {
+		return doc, false, errors.Annotate(err, ErrDecodingDocument, errorMessages)
+	}
+	return doc, true, nil
+}
+
+// selector adds the discriminator to the selector.
+func (c *Collection[T]) selector(selector find.Selector) find.Selector {
+	if c.options.field == "" {
+		return selector
+	}
+	return &discriminatedSelector{
+		selector: selector,
+		field:    c.options.field,
+		value:    c.options.value,
+	}
+}
+
+// discriminatedSelector combines a selector with the discriminator.
+type discriminatedSelector struct {
+	selector find.Selector
+	field    string
+	value    string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (ds *discriminatedSelector) MarshalJSON() ([]byte, error) {
+	criteria := []interface{}{
+		map[string]string{ds.field: ds.value},
+	}
+	if ds.selector != nil {
+		criteria = append(criteria, ds.selector)
+	}
+	return json.Marshal(map[string]interface{}{
+		"$and": criteria,
+	})
+}
+
+// EOF
@@ -0,0 +1,153 @@
+// Tideland Go CouchDB Client - Collection - Unit Tests
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package collection_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tideland/golib/audit"
+	"github.com/tideland/golib/etc"
+
+	"github.com/tideland/gocouch/collection"
+	"github.com/tideland/gocouch/couchdb"
+	"github.com/tideland/gocouch/find"
+	"github.com/tideland/gocouch/views"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	Cfg = "{etc {hostname localhost}{port 5984}{database tgocouch-testing-<<DATABASE>>}{debug-logging true}}"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestDocuments tests creating, reading, updating, and
+// deleting typed documents.
+func TestDocuments(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareDatabase("collection-documents", assert)
+	defer cleanup()
+	orders := collection.New[Order](cdb, collection.TypeField("order"))
+	notes := collection.New[Note](cdb, collection.TypeField("note"))
+
+	// Create and read an order.
+	order := &Order{Customer: "alice", Amount: 42}
+	err := orders.Create(order)
+	assert.Nil(err)
+	assert.True(order.ID != "")
+	assert.True(strings.HasPrefix(order.Revision, "1-"))
+	read, err := orders.Get(order.ID)
+	assert.Nil(err)
+	assert.Equal(read, *order)
+
+	// Update the order.
+	order.Amount = 4711
+	err = orders.Update(order)
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(order.Revision, "2-"))
+
+	// Documents of other collections aren't readable.
+	note := &Note{DocumentBase: couchdb.DocumentBase{ID: "note-1"}, Text: "hello"}
+	err = notes.Create(note)
+	assert.Nil(err)
+	_, err = orders.Get("note-1")
+	assert.ErrorMatch(err, `.*"note-1" is no "order".*`)
+	many, err := orders.GetMany([]string{order.ID, "note-1", "does-not-exist"})
+	assert.Nil(err)
+	assert.Length(many, 1)
+
+	// Delete the order.
+	err = orders.Delete(order)
+	assert.Nil(err)
+	_, err = orders.Get(order.ID)
+	assert.True(couchdb.IsNotFound(err))
+}
+
+// TestQueries tests finding documents and reading views.
+func TestQueries(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareDatabase("collection-queries", assert)
+	defer cleanup()
+	orders := collection.New[Order](cdb, collection.TypeField("order"))
+	notes := collection.New[Note](cdb, collection.TypeField("note"))
+
+	for i, customer := range []string{"alice", "bob", "alice", "carol"} {
+		err := orders.Create(&Order{Customer: customer, Amount: (i + 1) * 10})
+		assert.Nil(err)
+	}
+	err := notes.Create(&Note{Text: "alice"})
+	assert.Nil(err)
+
+	// Find documents.
+	found, err := orders.Find(find.Select(find.Equal("customer", "alice")))
+	assert.Nil(err)
+	assert.Length(found, 2)
+	count := 0
+	for order, err := range orders.FindSeq(find.Select(find.GreaterThan("amount", 15)), find.Streaming()) {
+		assert.Nil(err)
+		assert.True(order.Amount > 15)
+		count++
+	}
+	assert.Equal(count, 3)
+
+	// Read views.
+	design, err := cdb.Design("testing")
+	assert.Nil(err)
+	design.SetView("by-customer", "function(doc){ emit([doc.customer || doc.text, doc.amount || 0], doc.amount || 0); }", "")
+	rs := design.Write()
+	assert.True(rs.IsOK())
+	docs, err := orders.View("testing", "by-customer", views.StartKey([]interface{}{"alice"}), views.EndKey([]interface{}{"alice", map[string]interface{}{}}))
+	assert.Nil(err)
+	assert.Length(docs, 2)
+	rows, err := collection.ViewRows[[]interface{}, int](cdb, "testing", "by-customer")
+	assert.Nil(err)
+	assert.Length(rows, 5)
+	assert.Equal(rows[0].Key[0], "alice")
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// Order is a typed document for the tests.
+type Order struct {
+	couchdb.DocumentBase
+	Customer string `json:"customer"`
+	Amount   int    `json:"amount"`
+}
+
+// Note is another typed document for the tests.
+type Note struct {
+	couchdb.DocumentBase
+	Text string `json:"text"`
+}
+
+// prepareDatabase opens the database and deletes it first.
+func prepareDatabase(database string, assert audit.Assertion) (couchdb.CouchDB, func()) {
+	cfgstr := strings.Replace(Cfg, "<<DATABASE>>", database, 1)
+	cfg, err := etc.ReadString(cfgstr)
+	assert.Nil(err)
+	cdb, err := couchdb.Open(cfg)
+	assert.Nil(err)
+	cdb.DeleteDatabase()
+	rs := cdb.CreateDatabase()
+	assert.True(rs.IsOK())
+	return cdb, func() { cdb.DeleteDatabase() }
+}
+
+// EOF
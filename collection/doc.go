@@ -0,0 +1,37 @@
+// Tideland Go CouchDB Client - Collection
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package collection of the Tideland Go CouchDB Client provides a
+// typed access to the documents of a database. It builds on the
+// functions of the packages couchdb, find, and views.
+//
+// A Collection of the document type T is bound to a database and
+// optionally to a discriminator. It is a field like "type" set when
+// writing documents and checked when reading them. So multiple
+// collections can share one database.
+//
+//     orders := collection.New[Order](cdb, collection.TypeField("order"))
+//
+//     order := &Order{Customer: "alice", Amount: 42}
+//     err := orders.Create(order)
+//     order, err = orders.Get(order.ID)
+//
+// Writes set the ID and the new revision in the passed document.
+// Queries of package find and views return slices of T or iterators
+// for the processing of large results. These are range-over-func
+// iterators requiring Go 1.23 or later.
+//
+//     open, err := orders.Find(find.Select(find.Equal("state", "open")))
+//     for order, err := range orders.ViewSeq("orders", "by-customer", views.OneKey("alice")) {
+//         ...
+//     }
+//
+// The rows of views with typed keys and values are returned by
+// ViewRows().
+package collection
+
+// EOF
@@ -0,0 +1,39 @@
+// Tideland Go CouchDB Client - Collection - Errors
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package collection
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes of the package.
+const (
+	ErrTypeMismatch = iota + 1
+	ErrReadingDocument
+	ErrEncodingDocument
+	ErrDecodingDocument
+)
+
+// errorMessages contains the messages for the
+// individual error codes.
+var errorMessages = errors.Messages{
+	ErrTypeMismatch:     "document %q is no %q",
+	ErrReadingDocument:  "cannot read document %q: %s",
+	ErrEncodingDocument: "cannot encode document",
+	ErrDecodingDocument: "cannot decode document",
+}
+
+// EOF
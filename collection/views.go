@@ -0,0 +1,123 @@
+// Tideland Go CouchDB Client - Collection - Views
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package collection
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"iter"
+
+	"github.com/tideland/gocouch/couchdb"
+	"github.com/tideland/gocouch/views"
+)
+
+//--------------------
+// VIEW DOCUMENTS
+//--------------------
+
+// View returns the documents of the view rows. The documents
+// are included automatically, those with another discriminator
+// are skipped.
+func (c *Collection[T]) View(design, view string, params ...couchdb.Parameter) ([]T, error) {
+	docs := []T{}
+	for doc, err := range c.ViewSeq(design, view, params...) {
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// ViewSeq returns an iterator over the documents of the view
+// rows. Together with couchdb.Streaming() the rows are decoded
+// while they arrive.
+func (c *Collection[T]) ViewSeq(design, view string, params ...couchdb.Parameter) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		params := append(params[:len(params):len(params)], views.IncludeDocuments())
+		vrs := views.View(c.cdb, design, view, params...)
+		defer vrs.Close()
+		if !vrs.IsOK() {
+			yield(zero, vrs.Error())
+			return
+		}
+		err := vrs.RowsDo(func(id string, key, value, document couchdb.Unmarshable) error {
+			if document.String() == "" || document.String() == "null" {
+				return nil
+			}
+			doc, ok, err := c.decode(document, true)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			if !yield(doc, nil) {
+				return stopped{}
+			}
+			return nil
+		})
+		if _, ok := err.(stopped); err != nil && !ok {
+			yield(zero, err)
+		}
+	}
+}
+
+//--------------------
+// VIEW ROWS
+//--------------------
+
+// Row is a view row with typed key and value.
+type Row[K, V any] struct {
+	ID    string
+	Key   K
+	Value V
+}
+
+// ViewRows returns the rows of the view with typed keys and values.
+func ViewRows[K, V any](cdb couchdb.CouchDB, design, view string, params ...couchdb.Parameter) ([]Row[K, V], error) {
+	vrs := views.View(cdb, design, view, params...)
+	defer vrs.Close()
+	if !vrs.IsOK() {
+		return nil, vrs.Error()
+	}
+	rows := []Row[K, V]{}
+	err := vrs.RowsDo(func(id string, key, value, document couchdb.Unmarshable) error {
+		row := Row[K, V]{
+			ID: id,
+		}
+		if key.String() != "" {
+			if err := key.Unmarshal(&row.Key); err != nil {
+				return err
+			}
+		}
+		if value.String() != "" {
+			if err := value.Unmarshal(&row.Value); err != nil {
+				return err
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ViewRowsContext returns the rows of the view with typed keys
+// and values using the passed context.
+func ViewRowsContext[K, V any](ctx context.Context, cdb couchdb.CouchDB, design, view string, params ...couchdb.Parameter) ([]Row[K, V], error) {
+	return ViewRows[K, V](cdb.WithContext(ctx), design, view, params...)
+}
+
+// EOF
@@ -0,0 +1,347 @@
+// Tideland GoCouch - CouchDB - Attachments
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// ATTACHMENT
+//--------------------
+
+// Attachment provides streaming access to the content of a
+// document attachment. It has to be closed after reading. If
+// the digest of the complete content is known it's verified
+// when reaching the end of the content.
+type Attachment interface {
+	io.ReadCloser
+
+	// Name returns the name of the attachment.
+	Name() string
+
+	// ContentType returns the content type of the attachment.
+	ContentType() string
+
+	// Length returns the length of the content or -1
+	// if it's unknown.
+	Length() int64
+
+	// Digest returns the digest of the attachment in the
+	// CouchDB notation "md5-<base64>" if it's known.
+	Digest() string
+
+	// IsPartial returns true if only a range of the
+	// attachment has been requested.
+	IsPartial() bool
+}
+
+// AttachmentProcessor is a function processing an attachment
+// of a multipart document.
+type AttachmentProcessor func(attachment Attachment) error
+
+// attachment implements the Attachment interface.
+type attachment struct {
+	name        string
+	contentType string
+	length      int64
+	digest      string
+	partial     bool
+	body        io.ReadCloser
+	hash        hash.Hash
+}
+
+// newAttachment creates an attachment reading the body. The digest
+// is only verified if it's known and the content is complete.
+func newAttachment(name, contentType string, length int64, digest string, partial bool, body io.ReadCloser) *attachment {
+	a := &attachment{
+		name:        name,
+		contentType: contentType,
+		length:      length,
+		digest:      digest,
+		partial:     partial,
+		body:        body,
+	}
+	if strings.HasPrefix(digest, "md5-") && !partial {
+		a.hash = md5.New()
+	}
+	return a
+}
+
+// Name implements the Attachment interface.
+func (a *attachment) Name() string {
+	return a.name
+}
+
+// ContentType implements the Attachment interface.
+func (a *attachment) ContentType() string {
+	return a.contentType
+}
+
+// Length implements the Attachment interface.
+func (a *attachment) Length() int64 {
+	return a.length
+}
+
+// Digest implements the Attachment interface.
+func (a *attachment) Digest() string {
+	return a.digest
+}
+
+// IsPartial implements the Attachment interface.
+func (a *attachment) IsPartial() bool {
+	return a.partial
+}
+
+// Read implements the io.Reader interface.
+func (a *attachment) Read(p []byte) (int, error) {
+	n, err := a.body.Read(p)
+	if a.hash != nil {
+		a.hash.Write(p[:n])
+		if err == io.EOF {
+			digest := "md5-" + base64.StdEncoding.EncodeToString(a.hash.Sum(nil))
+			a.hash = nil
+			if digest != a.digest {
+				return n, errors.New(ErrInvalidDigest, errorMessages, a.name)
+			}
+		}
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (a *attachment) Close() error {
+	return a.body.Close()
+}
+
+//--------------------
+// MULTIPART DOCUMENT
+//--------------------
+
+// MultipartDocument contains a document read together with its
+// attachments. Those are streamed in the order CouchDB sends
+// them, so each one has to be processed before the next one
+// is read. The document has to be closed after usage.
+type MultipartDocument interface {
+	// Document unmarshals the document.
+	Document(value interface{}) error
+
+	// Attachments returns the information about the
+	// attachments of the document.
+	Attachments() AttachmentInfos
+
+	// AttachmentsDo iterates over the attachments and
+	// processes them.
+	AttachmentsDo(process AttachmentProcessor) error
+
+	// Close closes the underlying response.
+	Close() error
+}
+
+// multipartDocument implements the MultipartDocument interface.
+type multipartDocument struct {
+	document    json.RawMessage
+	attachments AttachmentInfos
+	reader      *multipart.Reader
+	body        io.ReadCloser
+}
+
+// newMultipartDocument reads the document out of the body. It can
+// be a multipart/related one or a JSON document if the document
+// has no attachments.
+func newMultipartDocument(contentType string, body io.ReadCloser) (*multipartDocument, error) {
+	md := &multipartDocument{
+		body: body,
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		body.Close()
+		return nil, errors.Annotate(err, ErrReadingMultipart, errorMessages)
+	}
+	var docReader io.Reader = body
+	if mediaType == "multipart/related" {
+		md.reader = multipart.NewReader(body, params["boundary"])
+		part, err := md.reader.NextPart()
+		if err != nil {
+			body.Close()
+			return nil, errors.Annotate(err, ErrReadingMultipart, errorMessages)
+		}
+		docReader = part
+	}
+	md.document, err = ioutil.ReadAll(docReader)
+	if err != nil {
+		body.Close()
+		return nil, errors.Annotate(err, ErrReadingResponseBody, errorMessages)
+	}
+	atts := couchdbAttachments{}
+	if err = json.Unmarshal(md.document, &atts); err != nil {
+		body.Close()
+		return nil, errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+	}
+	md.attachments = atts.Attachments
+	return md, nil
+}
+
+// Document implements the MultipartDocument interface.
+func (md *multipartDocument) Document(value interface{}) error {
+	err := json.Unmarshal(md.document, value)
+	if err != nil {
+		return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+	}
+	return nil
+}
+
+// Attachments implements the MultipartDocument interface.
+func (md *multipartDocument) Attachments() AttachmentInfos {
+	return md.attachments
+}
+
+// AttachmentsDo implements the MultipartDocument interface.
+func (md *multipartDocument) AttachmentsDo(process AttachmentProcessor) error {
+	if md.reader == nil {
+		return nil
+	}
+	for {
+		part, err := md.reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Annotate(err, ErrReadingMultipart, errorMessages)
+		}
+		name := part.FileName()
+		info := md.attachments[name]
+		contentType := part.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = info.ContentType
+		}
+		a := newAttachment(name, contentType, info.Length, info.Digest, false, part)
+		if err := process(a); err != nil {
+			return err
+		}
+	}
+}
+
+// Close implements the MultipartDocument interface.
+func (md *multipartDocument) Close() error {
+	return md.body.Close()
+}
+
+//--------------------
+// COUCHDB ATTACHMENT METHODS
+//--------------------
+
+// WriteAttachment implements the CouchDB interface.
+func (cdb *couchdb) WriteAttachment(id, revision, name, contentType string, r io.Reader, params ...Parameter) ResultSet {
+	req := newRequest(&cdb.server, cdb.DatabasePath(id, name), nil)
+	req.docReader = r
+	req.SetHeader("Content-Type", contentType)
+	if revision != "" {
+		req.SetQuery("rev", revision)
+	}
+	return req.apply(params...).put()
+}
+
+// ReadAttachment implements the CouchDB interface.
+func (cdb *couchdb) ReadAttachment(id, name string, params ...Parameter) (Attachment, error) {
+	req := newRequest(&cdb.server, cdb.DatabasePath(id, name), nil)
+	req.stream = true
+	req.SetHeader("Accept", "*/*")
+	rs := req.apply(params...).get()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	length := int64(-1)
+	if cl, err := strconv.ParseInt(rs.Header("Content-Length"), 10, 64); err == nil {
+		length = cl
+	}
+	digest := ""
+	if sum := rs.Header("Content-MD5"); sum != "" {
+		digest = "md5-" + sum
+	}
+	partial := rs.StatusCode() == http.StatusPartialContent
+	return newAttachment(name, rs.Header("Content-Type"), length, digest, partial, rs.stream), nil
+}
+
+// DeleteAttachment implements the CouchDB interface.
+func (cdb *couchdb) DeleteAttachment(id, revision, name string, params ...Parameter) ResultSet {
+	params = append(params, Revision(revision))
+	return cdb.Delete(cdb.DatabasePath(id, name), nil, params...)
+}
+
+// ListAttachments implements the CouchDB interface.
+func (cdb *couchdb) ListAttachments(id string, params ...Parameter) (AttachmentInfos, error) {
+	rs := cdb.ReadDocument(id, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	atts := couchdbAttachments{}
+	if err := rs.Document(&atts); err != nil {
+		return nil, err
+	}
+	if atts.Attachments == nil {
+		atts.Attachments = AttachmentInfos{}
+	}
+	return atts.Attachments, nil
+}
+
+// ReadDocumentWithAttachments implements the CouchDB interface.
+func (cdb *couchdb) ReadDocumentWithAttachments(id string, params ...Parameter) (MultipartDocument, error) {
+	req := newRequest(&cdb.server, cdb.DatabasePath(id), nil)
+	req.stream = true
+	req.SetQuery("attachments", "true")
+	req.SetHeader("Accept", "multipart/related")
+	rs := req.apply(params...).get()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	return newMultipartDocument(rs.Header("Content-Type"), rs.stream)
+}
+
+//--------------------
+// PARAMETERS
+//--------------------
+
+// Range sets the range of bytes to read from an attachment. A
+// negative value for last reads until the end.
+func Range(first, last int64) Parameter {
+	return func(pa Parameterizable) {
+		value := "bytes=" + strconv.FormatInt(first, 10) + "-"
+		if last >= 0 {
+			value += strconv.FormatInt(last, 10)
+		}
+		pa.SetHeader("Range", value)
+	}
+}
+
+// ContentMD5 sets the MD5 sum of an attachment to write, e.g.
+// calculated with md5.Sum(). So CouchDB verifies the received
+// content.
+func ContentMD5(sum []byte) Parameter {
+	return func(pa Parameterizable) {
+		pa.SetHeader("Content-MD5", base64.StdEncoding.EncodeToString(sum))
+	}
+}
+
+// EOF
@@ -0,0 +1,204 @@
+// Tideland GoCouch - CouchDB - Bulk Reading
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// BULK READ TYPES
+//--------------------
+
+// DocumentReference references a document by its ID and
+// optionally a revision.
+type DocumentReference struct {
+	ID       string `json:"id"`
+	Revision string `json:"rev,omitempty"`
+}
+
+// ReferencesTo creates references to the current revisions
+// of the documents with the given IDs.
+func ReferencesTo(ids ...string) []DocumentReference {
+	refs := make([]DocumentReference, len(ids))
+	for i, id := range ids {
+		refs[i].ID = id
+	}
+	return refs
+}
+
+// BulkReadResult is the result of reading one document
+// in a bulk read.
+type BulkReadResult struct {
+	ID       string
+	Revision string
+	Missing  bool
+	Deleted  bool
+	Error    string
+	Reason   string
+	Document Unmarshable
+}
+
+// IsFound returns true if the document has been found
+// and is not deleted.
+func (brr BulkReadResult) IsFound() bool {
+	return !brr.Missing && !brr.Deleted && brr.Error == ""
+}
+
+// BulkReadResults contains the results of a bulk read in
+// the order of the references.
+type BulkReadResults []BulkReadResult
+
+//--------------------
+// COUCHDB BULK READ METHODS
+//--------------------
+
+// BulkReadDocuments implements the CouchDB interface.
+func (cdb *couchdb) BulkReadDocuments(refs []DocumentReference, params ...Parameter) (BulkReadResults, error) {
+	if len(refs) == 0 {
+		return BulkReadResults{}, nil
+	}
+	ok, err := cdb.supportsBulkGet()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return cdb.bulkGet(refs, params...)
+	}
+	return cdb.bulkReadAllDocuments(refs, params...)
+}
+
+// bulkGet reads the documents using _bulk_get.
+func (cdb *couchdb) bulkGet(refs []DocumentReference, params ...Parameter) (BulkReadResults, error) {
+	bulk := couchdbBulkGet{
+		Docs: refs,
+	}
+	rs := cdb.Post(cdb.DatabasePath("_bulk_get"), bulk, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	response := couchdbBulkGetResponse{}
+	if err := rs.Document(&response); err != nil {
+		return nil, err
+	}
+	results := BulkReadResults{}
+	for _, result := range response.Results {
+		for _, doc := range result.Docs {
+			brr := BulkReadResult{
+				ID: result.ID,
+			}
+			switch {
+			case doc.OK != nil:
+				meta := RevisionMeta{}
+				if err := json.Unmarshal(doc.OK, &meta); err != nil {
+					return nil, errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+				}
+				brr.Revision = meta.Revision
+				brr.Deleted = meta.Deleted
+				brr.Document = NewUnmarshableJSON(doc.OK)
+			case doc.Error != nil:
+				brr.Revision = doc.Error.Revision
+				brr.Error = doc.Error.Error
+				brr.Reason = doc.Error.Reason
+				brr.analyzeError()
+			}
+			results = append(results, brr)
+		}
+	}
+	return results, nil
+}
+
+// bulkReadAllDocuments reads the documents using _all_docs with
+// keys. Documents with a given revision are read individually.
+func (cdb *couchdb) bulkReadAllDocuments(refs []DocumentReference, params ...Parameter) (BulkReadResults, error) {
+	keys := couchdbKeys{}
+	for _, ref := range refs {
+		if ref.Revision == "" {
+			keys.Keys = append(keys.Keys, ref.ID)
+		}
+	}
+	rows := map[string]couchdbAllDocumentsRow{}
+	if len(keys.Keys) > 0 {
+		allParams := append(params[:len(params):len(params)], Query(KeyValue{"include_docs", "true"}))
+		rs := cdb.Post(cdb.DatabasePath("_all_docs"), keys, allParams...)
+		if !rs.IsOK() {
+			return nil, rs.Error()
+		}
+		response := couchdbAllDocumentsRows{}
+		if err := rs.Document(&response); err != nil {
+			return nil, err
+		}
+		for _, row := range response.Rows {
+			rows[row.Key] = row
+		}
+	}
+	results := BulkReadResults{}
+	for _, ref := range refs {
+		brr := BulkReadResult{
+			ID: ref.ID,
+		}
+		if ref.Revision != "" {
+			brr.Revision = ref.Revision
+			rs := cdb.ReadDocument(ref.ID, append(params[:len(params):len(params)], Revision(ref.Revision))...)
+			if !rs.IsOK() {
+				if reqErr, ok := AsRequestError(rs.Error()); ok {
+					brr.Error = reqErr.ErrorText
+					brr.Reason = reqErr.Reason
+					brr.analyzeError()
+					results = append(results, brr)
+					continue
+				}
+				return nil, rs.Error()
+			}
+			raw, err := rs.Raw()
+			if err != nil {
+				return nil, err
+			}
+			brr.Deleted = rs.IsDeleted()
+			brr.Document = NewUnmarshableRaw(raw)
+			results = append(results, brr)
+			continue
+		}
+		row := rows[ref.ID]
+		switch {
+		case row.Error != "":
+			brr.Error = row.Error
+			brr.analyzeError()
+		case row.Value.Deleted:
+			brr.Revision = row.Value.Revision
+			brr.Deleted = true
+		default:
+			brr.Revision = row.Value.Revision
+			brr.Document = NewUnmarshableJSON(row.Document)
+		}
+		results = append(results, brr)
+	}
+	return results, nil
+}
+
+// analyzeError sets the flags based on error and reason.
+func (brr *BulkReadResult) analyzeError() {
+	if brr.Error != "not_found" {
+		return
+	}
+	if brr.Reason == "deleted" {
+		brr.Deleted = true
+	} else {
+		brr.Missing = true
+	}
+	brr.Error = ""
+	brr.Reason = ""
+}
+
+// EOF
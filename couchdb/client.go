@@ -0,0 +1,118 @@
+// Tideland GoCouch - CouchDB - HTTP Client
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/etc"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Supported schemes for the connection to the CouchDB.
+const (
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+)
+
+// maxIdleConnsPerHost defines how many keep-alive connections
+// per host are held by the transports of the package.
+const maxIdleConnsPerHost = 32
+
+//--------------------
+// HTTP CLIENT
+//--------------------
+
+// defaultClient is used by all connections without an own
+// TLS configuration or an explicitly passed client. It
+// shares its pooled keep-alive connections.
+var defaultClient = &http.Client{
+	Transport: newTransport(nil, 0),
+}
+
+// newTransport creates a transport with pooled keep-alive
+// connections and the optional TLS configuration. A timeout
+// limits connecting, the TLS handshake, and the waiting for
+// the response headers. It doesn't limit the reading of
+// responses, so streamed results are possible.
+func newTransport(tlsConfig *tls.Config, timeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	if timeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = timeout
+		transport.ResponseHeaderTimeout = timeout
+	}
+	return transport
+}
+
+// newClient returns the HTTP client for the configuration. Only
+// in case of a tls section or a timeout an own client is created,
+// otherwise the default client is used. The timeout of whole
+// requests is handled per request, see request.performHTTP().
+func newClient(cfg etc.Etc) (*http.Client, error) {
+	timeout := cfg.ValueAsDuration("timeout", 0)
+	if !cfg.HasPath("tls") {
+		if timeout == 0 {
+			return defaultClient, nil
+		}
+		client := &http.Client{
+			Transport: newTransport(nil, timeout),
+		}
+		return client, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.ValueAsBool("tls/insecure-skip-verify", false),
+	}
+	if caFile := cfg.ValueAsString("tls/ca-file", ""); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrConfiguringTLS, errorMessages)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(ErrConfiguringTLS, errorMessages)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	certFile := cfg.ValueAsString("tls/cert-file", "")
+	keyFile := cfg.ValueAsString("tls/key-file", "")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrConfiguringTLS, errorMessages)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	client := &http.Client{
+		Transport: newTransport(tlsConfig, timeout),
+	}
+	return client, nil
+}
+
+// EOF
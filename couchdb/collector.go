@@ -0,0 +1,174 @@
+// Tideland GoCouch - CouchDB - Statistics Collector
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+	"time"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// DefaultLatencyBounds are the upper bounds of the latency
+// histogram buckets if none are passed to the collector.
+var DefaultLatencyBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+//--------------------
+// STATISTICS COLLECTOR
+//--------------------
+
+// LatencyHistogram counts the durations of requests in buckets.
+// Counts[i] contains the requests up to Bounds[i], the last
+// count those above the largest bound.
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []int64
+	Sum    time.Duration
+	Min    time.Duration
+	Max    time.Duration
+}
+
+// Mean returns the mean duration of the requests.
+func (lh LatencyHistogram) Mean() time.Duration {
+	var count int64
+	for _, c := range lh.Counts {
+		count += c
+	}
+	if count == 0 {
+		return 0
+	}
+	return lh.Sum / time.Duration(count)
+}
+
+// EndpointStatistics contains the statistics of the
+// requests to one endpoint.
+type EndpointStatistics struct {
+	Method   string
+	Template string
+	Count    int64
+	Errors   int64
+	BytesOut int64
+	BytesIn  int64
+	Latency  LatencyHistogram
+}
+
+// ErrorRate returns the share of failed requests.
+func (es EndpointStatistics) ErrorRate() float64 {
+	if es.Count == 0 {
+		return 0
+	}
+	return float64(es.Errors) / float64(es.Count)
+}
+
+// StatisticsCollector is an observer collecting the statistics
+// of the requests per endpoint, which is method and path template.
+// Failed requests include those with error status codes.
+type StatisticsCollector struct {
+	mu        sync.Mutex
+	bounds    []time.Duration
+	endpoints map[string]*EndpointStatistics
+}
+
+// NewStatisticsCollector creates a collector using the given
+// latency bounds or DefaultLatencyBounds if none are passed.
+func NewStatisticsCollector(bounds ...time.Duration) *StatisticsCollector {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBounds
+	}
+	return &StatisticsCollector{
+		bounds:    append([]time.Duration{}, bounds...),
+		endpoints: map[string]*EndpointStatistics{},
+	}
+}
+
+// BeforeRequest implements the Observer interface.
+func (sc *StatisticsCollector) BeforeRequest(info *RequestInfo) {}
+
+// AfterRequest implements the Observer interface.
+func (sc *StatisticsCollector) AfterRequest(info *RequestInfo) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	key := info.Method + " " + info.Template
+	es, ok := sc.endpoints[key]
+	if !ok {
+		es = &EndpointStatistics{
+			Method:   info.Method,
+			Template: info.Template,
+			Latency: LatencyHistogram{
+				Bounds: sc.bounds,
+				Counts: make([]int64, len(sc.bounds)+1),
+				Min:    info.Duration,
+			},
+		}
+		sc.endpoints[key] = es
+	}
+	es.Count++
+	if info.Error != nil {
+		es.Errors++
+	}
+	es.BytesOut += info.BytesOut
+	if info.BytesIn > 0 {
+		es.BytesIn += info.BytesIn
+	}
+	lh := &es.Latency
+	bucket := len(lh.Bounds)
+	for i, bound := range lh.Bounds {
+		if info.Duration <= bound {
+			bucket = i
+			break
+		}
+	}
+	lh.Counts[bucket]++
+	lh.Sum += info.Duration
+	if info.Duration < lh.Min {
+		lh.Min = info.Duration
+	}
+	if info.Duration > lh.Max {
+		lh.Max = info.Duration
+	}
+}
+
+// Statistics returns a copy of the collected statistics
+// by method and path template like "GET /{db}/{docid}".
+func (sc *StatisticsCollector) Statistics() map[string]EndpointStatistics {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	stats := make(map[string]EndpointStatistics, len(sc.endpoints))
+	for key, es := range sc.endpoints {
+		copied := *es
+		copied.Latency.Counts = append([]int64{}, es.Latency.Counts...)
+		stats[key] = copied
+	}
+	return stats
+}
+
+// Reset clears the collected statistics.
+func (sc *StatisticsCollector) Reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.endpoints = map[string]*EndpointStatistics{}
+}
+
+// EOF
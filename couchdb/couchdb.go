@@ -12,10 +12,11 @@ package couchdb
 //--------------------
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"reflect"
-	"strings"
+	"io"
+	"time"
 
 	"github.com/tideland/golib/errors"
 	"github.com/tideland/golib/etc"
@@ -27,14 +28,34 @@ import (
 // COUCHDB
 //--------------------
 
+// DocumentProcessor is a function processing one document of
+// a list of documents. The document is nil if it's not included.
+type DocumentProcessor func(id, revision string, document Unmarshable) error
+
 // CouchDB provides the access to a database.
 type CouchDB interface {
+	// Server returns the handle of the server the
+	// database belongs to.
+	Server() Server
+
 	// Path creates a document path starting at root.
 	Path(parts ...string) string
 
 	// DatabasePath creates a document path for the database.
 	DatabasePath(parts ...string) string
 
+	// PartitionPath creates a path inside a partition of
+	// the database.
+	PartitionPath(partition string, parts ...string) string
+
+	// Context returns the context used for the requests.
+	Context() context.Context
+
+	// WithContext returns a shallow copy of the CouchDB using the
+	// passed context for all its requests. So requests can be
+	// cancelled or limited by deadlines.
+	WithContext(ctx context.Context) CouchDB
+
 	// Head performs a GET request against the configured database.
 	Head(path string, doc interface{}, params ...Parameter) ResultSet
 
@@ -66,9 +87,47 @@ type CouchDB interface {
 	// HasDatabase checks if the configured database exists.
 	HasDatabase() (bool, error)
 
-	// CreateDatabase creates the configured database.
+	// CreateDatabase creates the configured database. The parameter
+	// Partitioned() creates a partitioned database.
 	CreateDatabase(params ...Parameter) ResultSet
 
+	// IsPartitioned checks if the configured database is
+	// partitioned. The result is cached, a failed check
+	// for a minute.
+	IsPartitioned() (bool, error)
+
+	// ReadPartitionInfo returns the information about the
+	// partition of the configured database.
+	ReadPartitionInfo(partition string, params ...Parameter) (*PartitionInfo, error)
+
+	// ReadDatabaseInfo returns the information about the
+	// configured database.
+	ReadDatabaseInfo(params ...Parameter) (*DatabaseInfo, error)
+
+	// Compact starts the compaction of the configured database.
+	Compact(params ...Parameter) ResultSet
+
+	// CompactDesign starts the compaction of the views of the
+	// design document with the given ID.
+	CompactDesign(id string, params ...Parameter) ResultSet
+
+	// CleanupViews removes the index files of views not
+	// needed anymore.
+	CleanupViews(params ...Parameter) ResultSet
+
+	// ReadRevisionsLimit returns the maximum number of revisions
+	// tracked for the documents.
+	ReadRevisionsLimit(params ...Parameter) (int, error)
+
+	// WriteRevisionsLimit sets the maximum number of revisions
+	// tracked for the documents.
+	WriteRevisionsLimit(limit int, params ...Parameter) error
+
+	// WaitForCompaction polls the active tasks in the given interval
+	// until no compaction of the database or its views is running.
+	// It stops if the context of the database is done.
+	WaitForCompaction(interval time.Duration) error
+
 	// DeleteDatabase removes the configured database.
 	DeleteDatabase(params ...Parameter) ResultSet
 
@@ -84,10 +143,22 @@ type CouchDB interface {
 	// of the configured database.
 	AllDocuments() ([]string, error)
 
+	// AllDocumentsDo streams all documents of the configured
+	// database and processes them one by one. The documents
+	// are only passed when including them with the according
+	// view parameter.
+	AllDocumentsDo(process DocumentProcessor, params ...Parameter) error
+
+	// AllPartitionDocumentsDo streams all documents of the partition
+	// and processes them like AllDocumentsDo().
+	AllPartitionDocumentsDo(partition string, process DocumentProcessor, params ...Parameter) error
+
 	// HasDocument checks if the document with the ID exists.
 	HasDocument(id string) (bool, error)
 
-	// CreateDocument creates a new document.
+	// CreateDocument creates a new document. It can be a struct with the
+	// fields _id and _rev, also embedded like DocumentBase, a map, raw
+	// JSON, or an Identifiable.
 	CreateDocument(doc interface{}, params ...Parameter) ResultSet
 
 	// ReadDocument reads an existing document.
@@ -106,14 +177,82 @@ type CouchDB interface {
 	// BulkWriteDocuments allows to create or update many
 	// documents en bloc.
 	BulkWriteDocuments(docs []interface{}, params ...Parameter) (Statuses, error)
+
+	// BulkReadDocuments reads the referenced documents en bloc.
+	// The results tell if the documents are found, missing, or
+	// deleted.
+	BulkReadDocuments(refs []DocumentReference, params ...Parameter) (BulkReadResults, error)
+
+	// AllLocalDocuments returns a list of all local document IDs
+	// of the database. Their prefix is "_local/".
+	AllLocalDocuments(params ...Parameter) ([]string, error)
+
+	// HasLocalDocument checks if the local document with the ID exists.
+	HasLocalDocument(id string) (bool, error)
+
+	// CreateLocalDocument creates a new local document. Its ID is
+	// used with or without the local prefix.
+	CreateLocalDocument(doc interface{}, params ...Parameter) ResultSet
+
+	// ReadLocalDocument reads the local document with the ID.
+	ReadLocalDocument(id string, params ...Parameter) ResultSet
+
+	// UpdateLocalDocument allows to modify and update a local document.
+	UpdateLocalDocument(doc interface{}, params ...Parameter) ResultSet
+
+	// DeleteLocalDocument deletes an existing local document.
+	DeleteLocalDocument(doc interface{}, params ...Parameter) ResultSet
+
+	// DeleteLocalDocumentByID deletes an existing local document
+	// simply by its identifier and revision.
+	DeleteLocalDocumentByID(id, revision string, params ...Parameter) ResultSet
+
+	// ReadRevisionTree reads all branches of the revisions
+	// of the document.
+	ReadRevisionTree(id string, params ...Parameter) (*RevisionTree, error)
+
+	// ReadConflicts returns the leaf revisions of the document
+	// conflicting with the winning revision.
+	ReadConflicts(id string, params ...Parameter) ([]string, error)
+
+	// ReadVersions reads the versions of the document with the
+	// given revisions. Without revisions all leaf revisions are
+	// read.
+	ReadVersions(id string, revisions []string, params ...Parameter) ([]DocumentVersion, error)
+
+	// ResolveConflicts lets the resolver merge the conflicting
+	// versions of the document. The result is written as new
+	// revision of the winner while all others are deleted in
+	// one bulk write. The parameters are passed to the reads
+	// as well as to the write.
+	ResolveConflicts(id string, resolve ConflictResolver, params ...Parameter) (Statuses, error)
+
+	// WriteAttachment writes the content of the reader as attachment
+	// with the given name and content type to the document. An empty
+	// revision creates a new document.
+	WriteAttachment(id, revision, name, contentType string, r io.Reader, params ...Parameter) ResultSet
+
+	// ReadAttachment reads the attachment with the given name of
+	// the document. The content is streamed and has to be closed.
+	ReadAttachment(id, name string, params ...Parameter) (Attachment, error)
+
+	// DeleteAttachment deletes the attachment with the given name
+	// of the document.
+	DeleteAttachment(id, revision, name string, params ...Parameter) ResultSet
+
+	// ListAttachments returns the information about all attachments
+	// of the document.
+	ListAttachments(id string, params ...Parameter) (AttachmentInfos, error)
+
+	// ReadDocumentWithAttachments reads the document together with
+	// its attachments as multipart document.
+	ReadDocumentWithAttachments(id string, params ...Parameter) (MultipartDocument, error)
 }
 
 // couchdb implements CouchDB.
 type couchdb struct {
-	host       string
-	database   string
-	debugLog   bool
-	parameters []Parameter
+	server
+	database string
 }
 
 // Open returns a configured connection to a CouchDB server.
@@ -127,32 +266,17 @@ func Open(cfg etc.Etc, params ...Parameter) (CouchDB, error) {
 // leads to its location. Permanent parameters, e.g. for authentication,
 // are possible.
 func OpenPath(cfg etc.Etc, path string, params ...Parameter) (CouchDB, error) {
-	if cfg == nil {
-		return nil, errors.New(ErrNoConfiguration, errorMessages)
-	}
-	if path != "" {
-		var err error
-		cfg, err = cfg.Split(path)
-		if err != nil {
-			return nil, errors.New(ErrNoConfiguration, errorMessages)
-		}
-	}
-	host := fmt.Sprintf("%s:%d",
-		cfg.ValueAsString("hostname", "localhost"),
-		cfg.ValueAsInt("port", 5984),
-	)
-	cdb := &couchdb{
-		host:       host,
-		database:   cfg.ValueAsString("database", "default"),
-		debugLog:   cfg.ValueAsBool("debug-logging", false),
-		parameters: params,
+	srv, cfg, err := openServer(cfg, path, params...)
+	if err != nil {
+		return nil, err
 	}
-	return cdb, nil
+	return srv.Database(cfg.ValueAsString("database", "default")), nil
 }
 
-// Path implements the CouchDB interface.
-func (cdb *couchdb) Path(parts ...string) string {
-	return strings.Join(append([]string{""}, parts...), "/")
+// Server implements the CouchDB interface.
+func (cdb *couchdb) Server() Server {
+	srv := cdb.server
+	return &srv
 }
 
 // DatabasePath implements the CouchDB interface.
@@ -160,78 +284,14 @@ func (cdb *couchdb) DatabasePath(parts ...string) string {
 	return cdb.Path(append([]string{cdb.database}, parts...)...)
 }
 
-// Head implements the CouchDB interface.
-func (cdb *couchdb) Head(path string, doc interface{}, params ...Parameter) ResultSet {
-	req := newRequest(cdb, path, doc)
-	return req.apply(params...).head()
-}
-
-// Get implements the CouchDB interface.
-func (cdb *couchdb) Get(path string, doc interface{}, params ...Parameter) ResultSet {
-	req := newRequest(cdb, path, doc)
-	return req.apply(params...).get()
-}
-
-// Put implements the CouchDB interface.
-func (cdb *couchdb) Put(path string, doc interface{}, params ...Parameter) ResultSet {
-	req := newRequest(cdb, path, doc)
-	return req.apply(params...).put()
-}
-
-// Post implements the CouchDB interface.
-func (cdb *couchdb) Post(path string, doc interface{}, params ...Parameter) ResultSet {
-	req := newRequest(cdb, path, doc)
-	return req.apply(params...).post()
-}
-
-// Delete implements the CouchDB interface.
-func (cdb *couchdb) Delete(path string, doc interface{}, params ...Parameter) ResultSet {
-	req := newRequest(cdb, path, doc)
-	return req.apply(params...).delete()
-}
-
-// GetOrPost implements the CouchDB interface.
-func (cdb *couchdb) GetOrPost(path string, doc interface{}, params ...Parameter) ResultSet {
-	var rs ResultSet
-	req := newRequest(cdb, path, doc).apply(params...)
-	if req.doc != nil {
-		rs = req.post()
-	} else {
-		rs = req.get()
-	}
-	return rs
-}
-
-// Version implements the CouchDB interface.
-func (cdb *couchdb) Version() (version.Version, error) {
-	rs := cdb.Get("/", nil)
-	if !rs.IsOK() {
-		return nil, rs.Error()
-	}
-	welcome := map[string]interface{}{}
-	err := rs.Document(&welcome)
-	if err != nil {
-		return nil, err
-	}
-	vsnstr, ok := welcome["version"].(string)
-	if !ok {
-		return nil, errors.New(ErrInvalidVersion, errorMessages, welcome["version"])
+// WithContext implements the CouchDB interface.
+func (cdb *couchdb) WithContext(ctx context.Context) CouchDB {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	return version.Parse(vsnstr)
-}
-
-// AllDatabases implements the CouchDB interface.
-func (cdb *couchdb) AllDatabases() ([]string, error) {
-	rs := cdb.Get("/_all_dbs", nil)
-	if !rs.IsOK() {
-		return nil, rs.Error()
-	}
-	ids := []string{}
-	err := rs.Document(&ids)
-	if err != nil {
-		return nil, err
-	}
-	return ids, nil
+	ccdb := *cdb
+	ccdb.ctx = ctx
+	return &ccdb
 }
 
 // HasDatabase implements the CouchDB interface.
@@ -248,11 +308,13 @@ func (cdb *couchdb) HasDatabase() (bool, error) {
 
 // CreateDatabase implements the CouchDB interface.
 func (cdb *couchdb) CreateDatabase(params ...Parameter) ResultSet {
+	cdb.forgetPartitioned()
 	return cdb.Put(cdb.DatabasePath(), nil, params...)
 }
 
 // DeleteDatabase implements the CouchDB interface.
 func (cdb *couchdb) DeleteDatabase(params ...Parameter) ResultSet {
+	cdb.forgetPartitioned()
 	return cdb.Delete(cdb.DatabasePath(), nil, params...)
 }
 
@@ -284,22 +346,34 @@ func (cdb *couchdb) Design(id string) (Design, error) {
 
 // AllDocuments implements the CouchDB interface.
 func (cdb *couchdb) AllDocuments() ([]string, error) {
-	rs := cdb.Get(cdb.DatabasePath("_all_docs"), nil)
-	if !rs.IsOK() {
-		return nil, rs.Error()
-	}
-	designRows := couchdbRows{}
-	err := rs.Document(&designRows)
+	ids := []string{}
+	err := cdb.AllDocumentsDo(func(id, revision string, document Unmarshable) error {
+		ids = append(ids, id)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	ids := []string{}
-	for _, row := range designRows.Rows {
-		ids = append(ids, row.ID)
-	}
 	return ids, nil
 }
 
+// AllDocumentsDo implements the CouchDB interface.
+func (cdb *couchdb) AllDocumentsDo(process DocumentProcessor, params ...Parameter) error {
+	params = append(params, Streaming())
+	rs := cdb.GetOrPost(cdb.DatabasePath("_all_docs"), nil, params...)
+	return rs.RowsDo("rows", nil, func(raw json.RawMessage) error {
+		row := couchdbAllDocumentsRow{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		var document Unmarshable
+		if row.Document != nil {
+			document = NewUnmarshableJSON(row.Document)
+		}
+		return process(row.ID, row.Value.Revision, document)
+	})
+}
+
 // HasDocument implements the CouchDB interface.
 func (cdb *couchdb) HasDocument(id string) (bool, error) {
 	rs := cdb.Head(cdb.DatabasePath(id), nil)
@@ -314,13 +388,16 @@ func (cdb *couchdb) HasDocument(id string) (bool, error) {
 
 // CreateDocument implements the CouchDB interface.
 func (cdb *couchdb) CreateDocument(doc interface{}, params ...Parameter) ResultSet {
-	id, _, err := cdb.idAndRevision(doc)
+	id, _, err := idAndRevision(doc)
 	if err != nil {
 		return newResultSet(nil, err)
 	}
 	if id == "" {
 		id = identifier.NewUUID().ShortString()
 	}
+	if err = checkPartitionedID(cdb, id); err != nil {
+		return newResultSet(nil, err)
+	}
 	return cdb.Put(cdb.DatabasePath(id), doc, params...)
 }
 
@@ -331,7 +408,7 @@ func (cdb *couchdb) ReadDocument(id string, params ...Parameter) ResultSet {
 
 // UpdateDocument implements the CouchDB interface.
 func (cdb *couchdb) UpdateDocument(doc interface{}, params ...Parameter) ResultSet {
-	id, _, err := cdb.idAndRevision(doc)
+	id, _, err := idAndRevision(doc)
 	if err != nil {
 		return newResultSet(nil, err)
 	}
@@ -350,7 +427,7 @@ func (cdb *couchdb) UpdateDocument(doc interface{}, params ...Parameter) ResultS
 
 // DeleteDocument implements the CouchDB interface.
 func (cdb *couchdb) DeleteDocument(doc interface{}, params ...Parameter) ResultSet {
-	id, revision, err := cdb.idAndRevision(doc)
+	id, revision, err := idAndRevision(doc)
 	if err != nil {
 		return newResultSet(nil, err)
 	}
@@ -361,7 +438,7 @@ func (cdb *couchdb) DeleteDocument(doc interface{}, params ...Parameter) ResultS
 	if !hasDoc {
 		return newResultSet(nil, errors.New(ErrNotFound, errorMessages, id))
 	}
-	params = append(params, Revision(revision))
+	params = append(params, Revision(revision), writeBackTarget(doc))
 	return cdb.Delete(cdb.DatabasePath(id), nil, params...)
 }
 
@@ -395,38 +472,6 @@ func (cdb *couchdb) BulkWriteDocuments(docs []interface{}, params ...Parameter)
 	return statuses, nil
 }
 
-// idAndRevision retrieves the ID and the revision of the
-// passed document.
-func (cdb *couchdb) idAndRevision(doc interface{}) (string, string, error) {
-	v := reflect.Indirect(reflect.ValueOf(doc))
-	t := v.Type()
-	k := t.Kind()
-	if k != reflect.Struct {
-		return "", "", errors.New(ErrInvalidDocument, errorMessages)
-	}
-	var id string
-	var revision string
-	var found int
-	for i := 0; i < t.NumField(); i++ {
-		vf := v.Field(i)
-		tf := t.Field(i)
-		if json, ok := tf.Tag.Lookup("json"); ok {
-			switch json {
-			case "_id", "_id,omitempty":
-				id = vf.String()
-				found++
-			case "_rev", "_rev,omitempty":
-				revision = vf.String()
-				found++
-			}
-		}
-	}
-	if found != 2 {
-		return "", "", errors.New(ErrInvalidDocument, errorMessages)
-	}
-	return id, revision, nil
-}
-
 //--------------------
 // CONFIGURATION
 //--------------------
@@ -7,6 +7,14 @@
 
 package couchdb
 
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+)
+
 //--------------------
 // EXTERNAL DOCUMENT TYPES
 //--------------------
@@ -23,6 +31,208 @@ type Status struct {
 // Statuses is the list of status information after a bulk writing.
 type Statuses []Status
 
+// Sequence is a sequence of a database. CouchDB 1.x uses
+// numbers, CouchDB 2.x strings.
+type Sequence string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Sequence) UnmarshalJSON(data []byte) error {
+	var seq string
+	if err := json.Unmarshal(data, &seq); err == nil {
+		*s = Sequence(seq)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		*s = ""
+		return nil
+	}
+	*s = Sequence(num)
+	return nil
+}
+
+// DatabaseSizes contains the sizes of a database in bytes.
+type DatabaseSizes struct {
+	Active   int64 `json:"active"`
+	External int64 `json:"external"`
+	File     int64 `json:"file"`
+}
+
+// DatabaseCluster contains the cluster parameters of a database,
+// the number of shards q, the number of replicas n, and the
+// write and read quorums w and r.
+type DatabaseCluster struct {
+	Q int `json:"q"`
+	N int `json:"n"`
+	W int `json:"w"`
+	R int `json:"r"`
+}
+
+// DatabaseInfo contains the information about a database.
+type DatabaseInfo struct {
+	Name                 string
+	DocumentCount        int
+	DeletedDocumentCount int
+	UpdateSequence       Sequence
+	PurgeSequence        Sequence
+	CompactRunning       bool
+	DiskFormatVersion    int
+	InstanceStartTime    string
+	Sizes                DatabaseSizes
+	Cluster              DatabaseCluster
+	Partitioned          bool
+}
+
+// Types of active tasks.
+const (
+	TaskIndexer            = "indexer"
+	TaskDatabaseCompaction = "database_compaction"
+	TaskViewCompaction     = "view_compaction"
+	TaskReplication        = "replication"
+)
+
+// Task describes a task running on the server like an indexer,
+// a compaction, or a replication. Depending on the type only
+// some of the fields are set.
+type Task struct {
+	Type      string `json:"type"`
+	Node      string `json:"node"`
+	PID       string `json:"pid"`
+	Database  string `json:"database"`
+	Progress  int    `json:"progress"`
+	StartedOn int64  `json:"started_on"`
+	UpdatedOn int64  `json:"updated_on"`
+
+	// Indexers and compactions.
+	DesignDocument string `json:"design_document,omitempty"`
+	Phase          string `json:"phase,omitempty"`
+	ChangesDone    int    `json:"changes_done,omitempty"`
+	TotalChanges   int    `json:"total_changes,omitempty"`
+
+	// Replications.
+	ReplicationID         string   `json:"replication_id,omitempty"`
+	DocumentID            string   `json:"doc_id,omitempty"`
+	Source                string   `json:"source,omitempty"`
+	Target                string   `json:"target,omitempty"`
+	Continuous            bool     `json:"continuous,omitempty"`
+	User                  string   `json:"user,omitempty"`
+	ChangesPending        int      `json:"changes_pending,omitempty"`
+	DocsRead              int      `json:"docs_read,omitempty"`
+	DocsWritten           int      `json:"docs_written,omitempty"`
+	DocWriteFailures      int      `json:"doc_write_failures,omitempty"`
+	MissingRevisionsFound int      `json:"missing_revisions_found,omitempty"`
+	RevisionsChecked      int      `json:"revisions_checked,omitempty"`
+	SourceSequence        Sequence `json:"source_seq,omitempty"`
+	CheckpointedSequence  Sequence `json:"checkpointed_source_seq,omitempty"`
+	ThroughSequence       Sequence `json:"through_seq,omitempty"`
+}
+
+// Tasks is the list of active tasks of a server.
+type Tasks []Task
+
+// UserContext describes the authenticated user of a session.
+type UserContext struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// SessionInfo contains the information about a session.
+type SessionInfo struct {
+	OK          bool        `json:"ok"`
+	UserContext UserContext `json:"userCtx"`
+	Info        struct {
+		AuthenticationDB       string   `json:"authentication_db"`
+		AuthenticationHandlers []string `json:"authentication_handlers"`
+		Authenticated          string   `json:"authenticated"`
+	} `json:"info"`
+}
+
+// Membership contains the nodes of the cluster and all
+// nodes known to the contacted node.
+type Membership struct {
+	AllNodes     []string `json:"all_nodes"`
+	ClusterNodes []string `json:"cluster_nodes"`
+}
+
+// Status values of Up().
+const (
+	StatusUp              = "ok"
+	StatusMaintenanceMode = "maintenance_mode"
+	StatusNoLoadBalancing = "nolb"
+)
+
+// Histogram contains the values of a histogram metric.
+type Histogram struct {
+	N                 int          `json:"n"`
+	Min               float64      `json:"min"`
+	Max               float64      `json:"max"`
+	ArithmeticMean    float64      `json:"arithmetic_mean"`
+	GeometricMean     float64      `json:"geometric_mean"`
+	HarmonicMean      float64      `json:"harmonic_mean"`
+	Median            float64      `json:"median"`
+	Variance          float64      `json:"variance"`
+	StandardDeviation float64      `json:"standard_deviation"`
+	Skewness          float64      `json:"skewness"`
+	Kurtosis          float64      `json:"kurtosis"`
+	Percentile        [][2]float64 `json:"percentile"`
+	Histogram         [][2]float64 `json:"histogram"`
+}
+
+// Metric is one value of the statistics of a node. Counters
+// and gauges have a Value, histograms a Histogram.
+type Metric struct {
+	Type        string
+	Description string
+	Value       float64
+	Histogram   *Histogram
+}
+
+// Statistics contains the metrics of a node by their
+// dotted names like "couchdb.request_time".
+type Statistics map[string]Metric
+
+// System contains the system metrics of the Erlang VM of
+// a node. Memory and the message queues are by name.
+type System struct {
+	Uptime                  int64                      `json:"uptime"`
+	Memory                  map[string]int64           `json:"memory"`
+	RunQueue                int                        `json:"run_queue"`
+	ETSTableCount           int                        `json:"ets_table_count"`
+	ContextSwitches         int64                      `json:"context_switches"`
+	Reductions              int64                      `json:"reductions"`
+	GarbageCollectionCount  int64                      `json:"garbage_collection_count"`
+	WordsReclaimed          int64                      `json:"words_reclaimed"`
+	IOInput                 int64                      `json:"io_input"`
+	IOOutput                int64                      `json:"io_output"`
+	OSProcessCount          int                        `json:"os_proc_count"`
+	StaleProcessCount       int                        `json:"stale_proc_count"`
+	ProcessCount            int                        `json:"process_count"`
+	ProcessLimit            int                        `json:"process_limit"`
+	InternalReplicationJobs int                        `json:"internal_replication_jobs"`
+	MessageQueues           map[string]json.RawMessage `json:"message_queues"`
+}
+
+// Configuration contains the values of a node configuration
+// by section and key.
+type Configuration map[string]map[string]string
+
+// AttachmentInfo describes an attachment of a document as
+// contained in its _attachments field.
+type AttachmentInfo struct {
+	ContentType   string `json:"content_type"`
+	Length        int64  `json:"length"`
+	Digest        string `json:"digest"`
+	RevPos        int    `json:"revpos,omitempty"`
+	Stub          bool   `json:"stub,omitempty"`
+	Follows       bool   `json:"follows,omitempty"`
+	Encoding      string `json:"encoding,omitempty"`
+	EncodedLength int64  `json:"encoded_length,omitempty"`
+}
+
+// AttachmentInfos maps the names of the attachments
+// of a document to their information.
+type AttachmentInfos map[string]AttachmentInfo
+
 //--------------------
 // INTERNAL DOCUMENT TYPES
 //--------------------
@@ -41,6 +251,12 @@ type couchdbDocument struct {
 	Deleted  bool   `json:"_deleted"`
 }
 
+// couchdbAttachments is used to retrieve the attachment
+// information of a document.
+type couchdbAttachments struct {
+	Attachments AttachmentInfos `json:"_attachments"`
+}
+
 // couchdbRows returns rows containing IDs of documents. It's
 // part of a view document.
 type couchdbRows struct {
@@ -49,4 +265,111 @@ type couchdbRows struct {
 	}
 }
 
+// couchdbAllDocumentsRow is one row of the list of all
+// documents.
+type couchdbAllDocumentsRow struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Error string `json:"error,omitempty"`
+	Value struct {
+		Revision string `json:"rev"`
+		Deleted  bool   `json:"deleted,omitempty"`
+	} `json:"value"`
+	Document json.RawMessage `json:"doc,omitempty"`
+}
+
+// couchdbAllDocumentsRows is the list of all documents
+// read with keys.
+type couchdbAllDocumentsRows struct {
+	Rows []couchdbAllDocumentsRow `json:"rows"`
+}
+
+// couchdbPartitionInfo contains the information about a partition.
+type couchdbPartitionInfo struct {
+	DatabaseName         string        `json:"db_name"`
+	Partition            string        `json:"partition"`
+	DocumentCount        int           `json:"doc_count"`
+	DeletedDocumentCount int           `json:"doc_del_count"`
+	Sizes                DatabaseSizes `json:"sizes"`
+}
+
+// couchdbDatabaseInfo is the information about a database as
+// returned by CouchDB 1.x and 2.x.
+type couchdbDatabaseInfo struct {
+	Name                 string          `json:"db_name"`
+	DocumentCount        int             `json:"doc_count"`
+	DeletedDocumentCount int             `json:"doc_del_count"`
+	UpdateSequence       Sequence        `json:"update_seq"`
+	PurgeSequence        Sequence        `json:"purge_seq"`
+	CompactRunning       bool            `json:"compact_running"`
+	DiskFormatVersion    int             `json:"disk_format_version"`
+	InstanceStartTime    string          `json:"instance_start_time"`
+	DiskSize             int64           `json:"disk_size"`
+	DataSize             int64           `json:"data_size"`
+	Sizes                DatabaseSizes   `json:"sizes"`
+	Cluster              DatabaseCluster `json:"cluster"`
+	Props                struct {
+		Partitioned bool `json:"partitioned"`
+	} `json:"props"`
+}
+
+// couchdbMetric is one metric or a group of metrics
+// of the node statistics.
+type couchdbMetric struct {
+	Type        string          `json:"type"`
+	Description string          `json:"desc"`
+	Value       json.RawMessage `json:"value"`
+}
+
+// couchdbUp is the response of the health check.
+type couchdbUp struct {
+	Status string `json:"status"`
+}
+
+// couchdbUUIDs contains generated UUIDs.
+type couchdbUUIDs struct {
+	UUIDs []string `json:"uuids"`
+}
+
+// couchdbKeys sets the keys for requests of many documents.
+type couchdbKeys struct {
+	Keys []interface{} `json:"keys"`
+}
+
+// couchdbBulkGet contains the references of a bulk get.
+type couchdbBulkGet struct {
+	Docs []DocumentReference `json:"docs"`
+}
+
+// couchdbBulkGetResponse is the response of a bulk get.
+type couchdbBulkGetResponse struct {
+	Results []struct {
+		ID   string `json:"id"`
+		Docs []struct {
+			OK    json.RawMessage `json:"ok,omitempty"`
+			Error *struct {
+				ID       string `json:"id"`
+				Revision string `json:"rev"`
+				Error    string `json:"error"`
+				Reason   string `json:"reason"`
+			} `json:"error,omitempty"`
+		} `json:"docs"`
+	} `json:"results"`
+}
+
+// couchdbOpenRevision is one entry of a document read
+// with open revisions.
+type couchdbOpenRevision struct {
+	OK      json.RawMessage `json:"ok,omitempty"`
+	Missing string          `json:"missing,omitempty"`
+}
+
+// couchdbDeletedDocument marks a revision of a document
+// as deleted in bulk writes.
+type couchdbDeletedDocument struct {
+	ID       string `json:"_id"`
+	Revision string `json:"_rev"`
+	Deleted  bool   `json:"_deleted"`
+}
+
 // EOF
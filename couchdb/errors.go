@@ -12,6 +12,9 @@ package couchdb
 //--------------------
 
 import (
+	stderrors "errors"
+	"fmt"
+
 	"github.com/tideland/golib/errors"
 )
 
@@ -33,6 +36,17 @@ const (
 	ErrUnmarshallingDoc
 	ErrUnmarshallingField
 	ErrReadingResponseBody
+	ErrInvalidScheme
+	ErrConfiguringTLS
+	ErrCancelled
+	ErrInvalidDigest
+	ErrReadingMultipart
+	ErrStreamConsumed
+	ErrUnexpectedToken
+	ErrModifyingDocument
+	ErrResolvingConflicts
+	ErrInvalidURL
+	ErrInvalidPartition
 )
 
 // Error messages.
@@ -49,6 +63,129 @@ var errorMessages = errors.Messages{
 	ErrUnmarshallingDoc:    "cannot unmarshal database document",
 	ErrUnmarshallingField:  "cannot unmarshal the document field",
 	ErrReadingResponseBody: "cannot read response body",
+	ErrInvalidScheme:       "invalid scheme '%s', only 'http' and 'https' are supported",
+	ErrConfiguringTLS:      "cannot configure TLS",
+	ErrCancelled:           "request cancelled or deadline exceeded",
+	ErrInvalidDigest:       "digest of attachment '%s' does not match",
+	ErrReadingMultipart:    "cannot read multipart document",
+	ErrStreamConsumed:      "stream of result set already consumed",
+	ErrUnexpectedToken:     "unexpected token '%v', expected '%v'",
+	ErrModifyingDocument:   "cannot modify document '%s'",
+	ErrResolvingConflicts:  "cannot resolve conflicts of document '%s'",
+	ErrInvalidURL:          "invalid URL: %s",
+	ErrInvalidPartition:    "document ID '%s' needs the shape partition:docid",
+}
+
+//--------------------
+// REQUEST ERROR
+//--------------------
+
+// Sentinel errors for checking a RequestError with errors.Is().
+// The golib errors returned by the result sets don't unwrap, so
+// retrieve the RequestError with AsRequestError() first.
+var (
+	ErrConflict       = stderrors.New("document update conflict")
+	ErrNotFoundStatus = stderrors.New("database or document not found")
+	ErrUnauthorized   = stderrors.New("missing or invalid credentials")
+	ErrForbidden      = stderrors.New("missing permissions")
+)
+
+// RequestError describes a request CouchDB answered with an error
+// status code. It's returned annotated with ErrClientRequest, so
+// use AsRequestError() or the Is...() functions to check it. The
+// retrieved RequestError can be checked with errors.Is() using the
+// sentinel errors.
+type RequestError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	ErrorText  string
+	Reason     string
+	RequestID  string
+}
+
+// Error implements the error interface.
+func (re *RequestError) Error() string {
+	return fmt.Sprintf("status code %d, error '%s', reason '%s' (%s %s)",
+		re.StatusCode, re.ErrorText, re.Reason, re.Method, re.Path)
+}
+
+// Is checks if the status code matches one of the sentinel errors.
+func (re *RequestError) Is(target error) bool {
+	switch target {
+	case ErrConflict:
+		return re.StatusCode == StatusConflict
+	case ErrNotFoundStatus:
+		return re.StatusCode == StatusNotFound
+	case ErrUnauthorized:
+		return re.StatusCode == StatusUnauthorized
+	case ErrForbidden:
+		return re.StatusCode == StatusForbidden
+	}
+	return false
+}
+
+// AsRequestError returns the request error contained in the
+// annotation chain or the wrapped errors of err.
+func AsRequestError(err error) (*RequestError, bool) {
+	var reqErr *RequestError
+	found := inspect(err, func(e error) bool {
+		var ok bool
+		reqErr, ok = e.(*RequestError)
+		return ok
+	})
+	return reqErr, found
+}
+
+// IsConflict checks if err is caused by a document update conflict.
+func IsConflict(err error) bool {
+	return hasStatusCode(err, StatusConflict)
+}
+
+// IsNotFound checks if err is caused by a missing database or
+// document, also if it has been detected by the client.
+func IsNotFound(err error) bool {
+	return inspect(err, func(e error) bool {
+		if errors.IsError(e, ErrNotFound) {
+			return true
+		}
+		reqErr, ok := e.(*RequestError)
+		return ok && reqErr.StatusCode == StatusNotFound
+	})
+}
+
+// IsUnauthorized checks if err is caused by missing or
+// invalid credentials.
+func IsUnauthorized(err error) bool {
+	return hasStatusCode(err, StatusUnauthorized)
+}
+
+// IsForbidden checks if err is caused by missing permissions.
+func IsForbidden(err error) bool {
+	return hasStatusCode(err, StatusForbidden)
+}
+
+// hasStatusCode checks if err contains a request error
+// with the given status code.
+func hasStatusCode(err error, statusCode int) bool {
+	reqErr, ok := AsRequestError(err)
+	return ok && reqErr.StatusCode == statusCode
+}
+
+// inspect walks through the golib annotation chain and the wrapped
+// errors of err until f returns true.
+func inspect(err error, f func(error) bool) bool {
+	for err != nil {
+		if f(err) {
+			return true
+		}
+		if errors.Valid(err) {
+			err = errors.Annotated(err)
+			continue
+		}
+		err = stderrors.Unwrap(err)
+	}
+	return false
 }
 
 // EOF
@@ -0,0 +1,343 @@
+// Tideland GoCouch - CouchDB - Identity
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// IDENTITY
+//--------------------
+
+// Identifiable is implemented by documents providing their
+// ID and revision themselves.
+type Identifiable interface {
+	// DocumentIdentity returns ID and revision of the document.
+	DocumentIdentity() (id, revision string)
+}
+
+// IdentitySetter is implemented by documents taking their
+// ID and revision after a write.
+type IdentitySetter interface {
+	// SetDocumentIdentity sets ID and revision of the document.
+	SetDocumentIdentity(id, revision string)
+}
+
+// DocumentBase can be embedded in own document types for
+// the ID and revision fields.
+type DocumentBase struct {
+	ID       string `json:"_id,omitempty"`
+	Revision string `json:"_rev,omitempty"`
+}
+
+// DocumentIdentity implements the Identifiable interface.
+func (db *DocumentBase) DocumentIdentity() (string, string) {
+	if db == nil {
+		return "", ""
+	}
+	return db.ID, db.Revision
+}
+
+// SetDocumentIdentity implements the IdentitySetter interface.
+func (db *DocumentBase) SetDocumentIdentity(id, revision string) {
+	if db == nil {
+		return
+	}
+	db.ID = id
+	db.Revision = revision
+}
+
+//--------------------
+// PARAMETERS
+//--------------------
+
+// WriteBackIdentity lets the writing of a document set the
+// ID and the new revision in the passed document. This works
+// for pointers to structs, maps, raw JSON, and documents
+// implementing IdentitySetter. Others stay unchanged.
+func WriteBackIdentity() Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.writeBack = true
+		}
+	}
+}
+
+// writeBackTarget sets the document taking the identity
+// after a write without a document, like a deletion.
+func writeBackTarget(doc interface{}) Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.target = doc
+		}
+	}
+}
+
+// writeBackIdentity sets the ID and revision of a successful
+// write in the target document if wanted.
+func (req *request) writeBackIdentity(rs *resultSet) *resultSet {
+	if !req.writeBack || req.target == nil || !rs.IsOK() || rs.streamed {
+		return rs
+	}
+	revision := rs.Revision()
+	if revision == "" {
+		return rs
+	}
+	setIDAndRevision(req.target, rs.ID(), revision)
+	return rs
+}
+
+//--------------------
+// DOCUMENT FIELDS
+//--------------------
+
+// documentFields contains the indexes of the ID and the
+// revision fields of a struct type.
+type documentFields struct {
+	id       []int
+	revision []int
+}
+
+// documentFieldsCache caches the fields per type. Types
+// without the fields are cached with nil.
+var documentFieldsCache sync.Map
+
+// fieldsOf returns the cached or analyzed fields of the struct type.
+func fieldsOf(t reflect.Type) *documentFields {
+	if cached, ok := documentFieldsCache.Load(t); ok {
+		return cached.(*documentFields)
+	}
+	fields := &documentFields{}
+	fields.id, fields.revision = lookupFields(t, nil, map[reflect.Type]bool{})
+	if fields.id == nil || fields.revision == nil {
+		fields = nil
+	}
+	documentFieldsCache.Store(t, fields)
+	return fields
+}
+
+// lookupFields searches the ID and revision fields of the struct
+// type. Like in JSON fields of the struct win over fields of
+// embedded structs. Visited types are tracked per path to stop
+// recursive embeddings, so types embedded via multiple paths are
+// analyzed on each.
+func lookupFields(t reflect.Type, index []int, visited map[reflect.Type]bool) ([]int, []int) {
+	if visited[t] {
+		return nil, nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	var id, revision []int
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		tf := t.Field(i)
+		name := strings.Split(tf.Tag.Get("json"), ",")[0]
+		fieldIndex := append(append([]int{}, index...), i)
+		switch {
+		case name == "-":
+			continue
+		case name == "_id" && tf.Type.Kind() == reflect.String:
+			id = fieldIndex
+		case name == "_rev" && tf.Type.Kind() == reflect.String:
+			revision = fieldIndex
+		case name == "" && tf.Anonymous:
+			embedded = append(embedded, tf)
+		}
+	}
+	for _, tf := range embedded {
+		et := tf.Type
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if et.Kind() != reflect.Struct {
+			continue
+		}
+		eid, erevision := lookupFields(et, append(append([]int{}, index...), tf.Index...), visited)
+		if id == nil {
+			id = eid
+		}
+		if revision == nil {
+			revision = erevision
+		}
+	}
+	return id, revision
+}
+
+// fieldByIndex returns the field with the index. Nil embedded
+// pointers are allocated if wanted, otherwise an invalid value
+// is returned.
+func fieldByIndex(v reflect.Value, index []int, allocate bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !allocate || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// idAndRevision retrieves the ID and the revision of the
+// passed document. It can be an Identifiable, a struct with
+// the fields _id and _rev, also embedded, a map, or raw JSON.
+func idAndRevision(doc interface{}) (string, string, error) {
+	if identifiable, ok := doc.(Identifiable); ok {
+		id, revision := identifiable.DocumentIdentity()
+		return id, revision, nil
+	}
+	switch raw := doc.(type) {
+	case json.RawMessage:
+		return rawIDAndRevision(raw)
+	case *json.RawMessage:
+		if raw != nil {
+			return rawIDAndRevision(*raw)
+		}
+	}
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	if !v.IsValid() {
+		return "", "", errors.New(ErrInvalidDocument, errorMessages)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := fieldsOf(v.Type())
+		if fields == nil {
+			return "", "", errors.New(ErrInvalidDocument, errorMessages)
+		}
+		var id, revision string
+		if vf := fieldByIndex(v, fields.id, false); vf.IsValid() {
+			id = vf.String()
+		}
+		if vf := fieldByIndex(v, fields.revision, false); vf.IsValid() {
+			revision = vf.String()
+		}
+		return id, revision, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return "", "", errors.New(ErrInvalidDocument, errorMessages)
+		}
+		id, ok := mapString(v, "_id")
+		if !ok {
+			return "", "", errors.New(ErrInvalidDocument, errorMessages)
+		}
+		revision, ok := mapString(v, "_rev")
+		if !ok {
+			return "", "", errors.New(ErrInvalidDocument, errorMessages)
+		}
+		return id, revision, nil
+	}
+	return "", "", errors.New(ErrInvalidDocument, errorMessages)
+}
+
+// rawIDAndRevision retrieves the ID and the revision
+// of a raw JSON document.
+func rawIDAndRevision(raw json.RawMessage) (string, string, error) {
+	identity := DocumentBase{}
+	if err := json.Unmarshal(raw, &identity); err != nil {
+		return "", "", errors.Annotate(err, ErrInvalidDocument, errorMessages)
+	}
+	return identity.ID, identity.Revision, nil
+}
+
+// mapString returns the string value of the key in the map.
+// Missing keys return an empty string.
+func mapString(v reflect.Value, key string) (string, bool) {
+	value := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+	if !value.IsValid() {
+		return "", true
+	}
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", true
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.String {
+		return "", false
+	}
+	return value.String(), true
+}
+
+// setIDAndRevision sets the ID and the revision of the
+// passed document if possible.
+func setIDAndRevision(doc interface{}, id, revision string) bool {
+	if raw, ok := doc.(*json.RawMessage); ok {
+		if raw == nil {
+			return false
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(*raw, &fields); err != nil {
+			return false
+		}
+		fields["_id"] = id
+		fields["_rev"] = revision
+		marshalled, err := json.Marshal(fields)
+		if err != nil {
+			return false
+		}
+		*raw = marshalled
+		return true
+	}
+	v := reflect.ValueOf(doc)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := fieldsOf(v.Type())
+		if fields != nil && v.CanSet() {
+			vid := fieldByIndex(v, fields.id, true)
+			vrevision := fieldByIndex(v, fields.revision, true)
+			if vid.CanSet() && vrevision.CanSet() {
+				vid.SetString(id)
+				vrevision.SetString(revision)
+				return true
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		et := v.Type().Elem()
+		if !reflect.TypeOf(id).ConvertibleTo(et) {
+			return false
+		}
+		key := v.Type().Key()
+		v.SetMapIndex(reflect.ValueOf("_id").Convert(key), reflect.ValueOf(id).Convert(et))
+		v.SetMapIndex(reflect.ValueOf("_rev").Convert(key), reflect.ValueOf(revision).Convert(et))
+		return true
+	}
+	if setter, ok := doc.(IdentitySetter); ok {
+		setter.SetDocumentIdentity(id, revision)
+		return true
+	}
+	return false
+}
+
+// EOF
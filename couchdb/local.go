@@ -0,0 +1,128 @@
+// Tideland GoCouch - CouchDB - Local Documents
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/identifier"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// LocalPrefix is the prefix of the IDs of local documents. They
+// are not replicated and not contained in views or changes.
+const LocalPrefix = "_local/"
+
+//--------------------
+// COUCHDB LOCAL DOCUMENT METHODS
+//--------------------
+
+// AllLocalDocuments implements the CouchDB interface.
+func (cdb *couchdb) AllLocalDocuments(params ...Parameter) ([]string, error) {
+	rs := cdb.Get(cdb.DatabasePath("_local_docs"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	localRows := couchdbRows{}
+	err := rs.Document(&localRows)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, row := range localRows.Rows {
+		ids = append(ids, row.ID)
+	}
+	return ids, nil
+}
+
+// HasLocalDocument implements the CouchDB interface.
+func (cdb *couchdb) HasLocalDocument(id string) (bool, error) {
+	rs := cdb.ReadLocalDocument(id)
+	if rs.IsOK() {
+		return true, nil
+	}
+	if rs.StatusCode() == StatusNotFound {
+		return false, nil
+	}
+	return false, rs.Error()
+}
+
+// CreateLocalDocument implements the CouchDB interface.
+func (cdb *couchdb) CreateLocalDocument(doc interface{}, params ...Parameter) ResultSet {
+	id, _, err := idAndRevision(doc)
+	if err != nil {
+		return newResultSet(nil, err)
+	}
+	if id == "" {
+		id = identifier.NewUUID().ShortString()
+	}
+	return cdb.Put(cdb.localPath(id), doc, params...)
+}
+
+// ReadLocalDocument implements the CouchDB interface.
+func (cdb *couchdb) ReadLocalDocument(id string, params ...Parameter) ResultSet {
+	return cdb.Get(cdb.localPath(id), nil, params...)
+}
+
+// UpdateLocalDocument implements the CouchDB interface.
+func (cdb *couchdb) UpdateLocalDocument(doc interface{}, params ...Parameter) ResultSet {
+	id, _, err := idAndRevision(doc)
+	if err != nil {
+		return newResultSet(nil, err)
+	}
+	if id == "" {
+		return newResultSet(nil, errors.New(ErrNoIdentifier, errorMessages))
+	}
+	hasDoc, err := cdb.HasLocalDocument(id)
+	if err != nil {
+		return newResultSet(nil, err)
+	}
+	if !hasDoc {
+		return newResultSet(nil, errors.New(ErrNotFound, errorMessages, id))
+	}
+	return cdb.Put(cdb.localPath(id), doc, params...)
+}
+
+// DeleteLocalDocument implements the CouchDB interface.
+func (cdb *couchdb) DeleteLocalDocument(doc interface{}, params ...Parameter) ResultSet {
+	id, revision, err := idAndRevision(doc)
+	if err != nil {
+		return newResultSet(nil, err)
+	}
+	params = append(params, writeBackTarget(doc))
+	return cdb.DeleteLocalDocumentByID(id, revision, params...)
+}
+
+// DeleteLocalDocumentByID implements the CouchDB interface.
+func (cdb *couchdb) DeleteLocalDocumentByID(id, revision string, params ...Parameter) ResultSet {
+	hasDoc, err := cdb.HasLocalDocument(id)
+	if err != nil {
+		return newResultSet(nil, err)
+	}
+	if !hasDoc {
+		return newResultSet(nil, errors.New(ErrNotFound, errorMessages, id))
+	}
+	params = append(params, Revision(revision))
+	return cdb.Delete(cdb.localPath(id), nil, params...)
+}
+
+// localPath returns the path of the local document with the
+// given ID. The ID may contain the local prefix or not.
+func (cdb *couchdb) localPath(id string) string {
+	return cdb.DatabasePath("_local", strings.TrimPrefix(id, LocalPrefix))
+}
+
+// EOF
@@ -0,0 +1,276 @@
+// Tideland GoCouch - CouchDB - Logging
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Redacted replaces secret values in logged headers and bodies.
+const Redacted = "<redacted>"
+
+// redactedKeys contains the lower case names of headers and
+// document fields whose values are redacted.
+var redactedKeys = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"password":            true,
+	"password_sha":        true,
+	"derived_key":         true,
+	"salt":                true,
+}
+
+//--------------------
+// LOGGER
+//--------------------
+
+// LogEntry contains the information about one attempt of a request.
+// Secret headers and document fields are already redacted. The bodies
+// are only set if logging them is enabled with LogBodies().
+type LogEntry struct {
+	Message      string
+	Method       string
+	Path         string
+	Query        string
+	Attempt      int
+	StatusCode   int
+	Duration     time.Duration
+	RequestID    string
+	Header       http.Header
+	RequestBody  string
+	ResponseBody string
+	Error        error
+}
+
+// Fields returns the set fields of the entry as alternating
+// keys and values.
+func (le *LogEntry) Fields() []interface{} {
+	fields := []interface{}{"method", le.Method, "path", le.Path}
+	if le.Query != "" {
+		fields = append(fields, "query", le.Query)
+	}
+	fields = append(fields, "attempt", le.Attempt)
+	if le.StatusCode != 0 {
+		fields = append(fields, "status", le.StatusCode)
+	}
+	fields = append(fields, "duration", le.Duration)
+	if le.RequestID != "" {
+		fields = append(fields, "request_id", le.RequestID)
+	}
+	if len(le.Header) > 0 {
+		fields = append(fields, "header", le.Header)
+	}
+	if le.RequestBody != "" {
+		fields = append(fields, "request_body", le.RequestBody)
+	}
+	if le.ResponseBody != "" {
+		fields = append(fields, "response_body", le.ResponseBody)
+	}
+	if le.Error != nil {
+		fields = append(fields, "error", le.Error)
+	}
+	return fields
+}
+
+// String returns the entry as message followed by
+// the fields as key/value pairs.
+func (le *LogEntry) String() string {
+	parts := []string{le.Message}
+	fields := le.Fields()
+	for i := 0; i < len(fields); i += 2 {
+		parts = append(parts, fmt.Sprintf("%v=%v", fields[i], fields[i+1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Logger receives the log entries of the requests.
+type Logger interface {
+	// LogRequest logs one attempt of a request.
+	LogRequest(entry *LogEntry)
+}
+
+// NewSlogLogger returns a Logger writing the entries with the
+// given level to the slog logger. Failed requests are logged
+// with at least the level warning.
+func NewSlogLogger(l *slog.Logger, level slog.Level) Logger {
+	return &slogLogger{
+		logger: l,
+		level:  level,
+	}
+}
+
+// slogLogger implements Logger for slog.
+type slogLogger struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// LogRequest implements the Logger interface.
+func (sl *slogLogger) LogRequest(entry *LogEntry) {
+	level := sl.level
+	if entry.Error != nil && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	sl.logger.Log(context.Background(), level, entry.Message, entry.Fields()...)
+}
+
+// golibLogger implements Logger for the debug logging
+// of the configuration.
+type golibLogger struct{}
+
+// LogRequest implements the Logger interface.
+func (gl golibLogger) LogRequest(entry *LogEntry) {
+	logger.Debugf("%s", entry.String())
+}
+
+//--------------------
+// PARAMETERS
+//--------------------
+
+// Logging sets the logger for the requests. Passed as permanent
+// parameter when opening the database or the server it replaces
+// the debug logging of the configuration.
+func Logging(logger Logger) Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.logger = logger
+		}
+	}
+}
+
+// LogBodies lets the logger also log the request and response
+// bodies up to the given size. Secret fields are redacted.
+func LogBodies(limit int) Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.logBodyLimit = limit
+		}
+	}
+}
+
+//--------------------
+// REDACTION
+//--------------------
+
+// redactHeader returns a copy of the header with
+// redacted secret values.
+func redactHeader(header http.Header) http.Header {
+	redacted := http.Header{}
+	for key, values := range header {
+		if redactedKeys[strings.ToLower(key)] {
+			redacted[key] = []string{Redacted}
+			continue
+		}
+		redacted[key] = append([]string{}, values...)
+	}
+	return redacted
+}
+
+// redactQuery returns the query with redacted secret parameters
+// and URLs without user information.
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Redacted
+	}
+	for key, values := range query {
+		if redactedKeys[strings.ToLower(key)] {
+			query[key] = []string{Redacted}
+			continue
+		}
+		for i, value := range values {
+			values[i] = redactURL(value)
+		}
+	}
+	return query.Encode()
+}
+
+// redactURL removes the user information like credentials
+// if the value is a URL.
+func redactURL(value string) string {
+	if !strings.Contains(value, "@") || !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = nil
+	return u.String()
+}
+
+// redactBody returns the body with redacted secret fields and
+// limited to the given size. Bodies of the administrator
+// configuration are redacted completely, others not containing
+// JSON are only logged with their size.
+func redactBody(path string, body []byte, limit int) string {
+	if len(body) == 0 || limit <= 0 {
+		return ""
+	}
+	if strings.Contains(path, "/_config/admins") {
+		return Redacted
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	redacted, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	if len(redacted) > limit {
+		return string(redacted[:limit]) + "..."
+	}
+	return string(redacted)
+}
+
+// redactValue redacts the secret fields of the value
+// and its nested values. URLs lose their user information.
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redactURL(v)
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactedKeys[strings.ToLower(key)] {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = redactValue(element)
+		}
+	}
+	return value
+}
+
+// EOF
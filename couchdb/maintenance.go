@@ -0,0 +1,132 @@
+// Tideland GoCouch - CouchDB - Maintenance
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// COUCHDB MAINTENANCE METHODS
+//--------------------
+
+// ReadDatabaseInfo implements the CouchDB interface.
+func (cdb *couchdb) ReadDatabaseInfo(params ...Parameter) (*DatabaseInfo, error) {
+	rs := cdb.Get(cdb.DatabasePath(), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	info := couchdbDatabaseInfo{}
+	err := rs.Document(&info)
+	if err != nil {
+		return nil, err
+	}
+	dbi := &DatabaseInfo{
+		Name:                 info.Name,
+		DocumentCount:        info.DocumentCount,
+		DeletedDocumentCount: info.DeletedDocumentCount,
+		UpdateSequence:       info.UpdateSequence,
+		PurgeSequence:        info.PurgeSequence,
+		CompactRunning:       info.CompactRunning,
+		DiskFormatVersion:    info.DiskFormatVersion,
+		InstanceStartTime:    info.InstanceStartTime,
+		Sizes:                info.Sizes,
+		Cluster:              info.Cluster,
+		Partitioned:          info.Props.Partitioned,
+	}
+	// Older servers only return the disk and data size.
+	if dbi.Sizes.File == 0 {
+		dbi.Sizes.File = info.DiskSize
+	}
+	if dbi.Sizes.Active == 0 {
+		dbi.Sizes.Active = info.DataSize
+	}
+	return dbi, nil
+}
+
+// Compact implements the CouchDB interface.
+func (cdb *couchdb) Compact(params ...Parameter) ResultSet {
+	return cdb.Post(cdb.DatabasePath("_compact"), nil, params...)
+}
+
+// CompactDesign implements the CouchDB interface.
+func (cdb *couchdb) CompactDesign(id string, params ...Parameter) ResultSet {
+	return cdb.Post(cdb.DatabasePath("_compact", id), nil, params...)
+}
+
+// CleanupViews implements the CouchDB interface.
+func (cdb *couchdb) CleanupViews(params ...Parameter) ResultSet {
+	return cdb.Post(cdb.DatabasePath("_view_cleanup"), nil, params...)
+}
+
+// ReadRevisionsLimit implements the CouchDB interface.
+func (cdb *couchdb) ReadRevisionsLimit(params ...Parameter) (int, error) {
+	rs := cdb.Get(cdb.DatabasePath("_revs_limit"), nil, params...)
+	if !rs.IsOK() {
+		return 0, rs.Error()
+	}
+	var limit int
+	err := rs.Document(&limit)
+	if err != nil {
+		return 0, err
+	}
+	return limit, nil
+}
+
+// WriteRevisionsLimit implements the CouchDB interface.
+func (cdb *couchdb) WriteRevisionsLimit(limit int, params ...Parameter) error {
+	rs := cdb.Put(cdb.DatabasePath("_revs_limit"), limit, params...)
+	return rs.Error()
+}
+
+// WaitForCompaction implements the CouchDB interface.
+func (cdb *couchdb) WaitForCompaction(interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		tasks, err := cdb.ActiveTasks()
+		if err != nil {
+			return err
+		}
+		if !cdb.isCompacting(tasks) {
+			return nil
+		}
+		if !sleep(cdb.ctx, interval) {
+			return errors.Annotate(cdb.ctx.Err(), ErrCancelled, errorMessages)
+		}
+	}
+}
+
+// isCompacting checks if one of the tasks compacts the database
+// or one of its views. CouchDB 2.x names the shards of the
+// database like "shards/00000000-1fffffff/name.1510000000".
+func (cdb *couchdb) isCompacting(tasks Tasks) bool {
+	for _, task := range tasks {
+		if task.Type != TaskDatabaseCompaction && task.Type != TaskViewCompaction {
+			continue
+		}
+		if task.Database == cdb.database {
+			return true
+		}
+		if strings.HasPrefix(task.Database, "shards/") &&
+			strings.Contains(task.Database, "/"+cdb.database+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// EOF
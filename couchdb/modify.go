@@ -0,0 +1,81 @@
+// Tideland GoCouch - CouchDB - Modify
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"reflect"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// MODIFY
+//--------------------
+
+// Modifier is a function changing the passed document before
+// it is written back.
+type Modifier func(doc interface{}) error
+
+// ModifyDocument reads the latest revision of the document with the
+// given ID into doc, lets modify change it, and writes it back. In case
+// of a conflict this is repeated up to the given number of attempts.
+// Before each attempt doc is reset to its zero value and filled with the
+// read document or, if it doesn't exist, with a copy of its initial value
+// to write it as new document. The copy is done by assignment, so fields
+// ignored by JSON are kept while maps, slices, and pointers are shared
+// with the initial value. The parameters are only used for writing.
+func ModifyDocument(cdb CouchDB, id string, doc interface{}, modify Modifier, attempts int, params ...Parameter) ResultSet {
+	v := reflect.ValueOf(doc)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return newResultSet(nil, errors.New(ErrInvalidDocument, errorMessages))
+	}
+	if _, _, err := idAndRevision(doc); err != nil {
+		return newResultSet(nil, err)
+	}
+	if err := checkPartitionedID(cdb, id); err != nil {
+		return newResultSet(nil, err)
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	// Keep a copy of the initial value.
+	initial := reflect.New(v.Elem().Type()).Elem()
+	initial.Set(v.Elem())
+	zero := reflect.Zero(v.Elem().Type())
+	var rs ResultSet
+	for attempt := 1; attempt <= attempts; attempt++ {
+		// Read the latest revision if the document exists.
+		v.Elem().Set(zero)
+		rs = cdb.ReadDocument(id)
+		switch {
+		case rs.IsOK():
+			if err := rs.Document(doc); err != nil {
+				return newResultSet(nil, err)
+			}
+		case rs.StatusCode() == StatusNotFound:
+			v.Elem().Set(initial)
+		default:
+			return rs
+		}
+		// Modify and write it.
+		if err := modify(doc); err != nil {
+			return newResultSet(nil, errors.Annotate(err, ErrModifyingDocument, errorMessages, id))
+		}
+		rs = cdb.Put(cdb.DatabasePath(id), doc, params...)
+		if rs.StatusCode() != StatusConflict {
+			return rs
+		}
+	}
+	return rs
+}
+
+// EOF
@@ -0,0 +1,213 @@
+// Tideland GoCouch - CouchDB - Observer
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//--------------------
+// OBSERVER
+//--------------------
+
+// RequestInfo describes one attempt of a request. Before the request
+// an observer may replace the context, e.g. with one containing a
+// trace span, and set headers. After the request the status code,
+// the transferred bytes, the duration, and a possible error are set.
+// StatusCode is 0 if no response has been received, e.g. due to a
+// network error or a cancellation; Error contains the reason then.
+type RequestInfo struct {
+	Context    context.Context
+	Method     string
+	Path       string
+	Template   string
+	Attempt    int
+	Header     http.Header
+	StatusCode int
+	BytesOut   int64
+	BytesIn    int64
+	Duration   time.Duration
+	Error      error
+}
+
+// Observer is called before and after each attempt of a request.
+// It is registered with the parameter Observe() when opening the
+// database or the server.
+type Observer interface {
+	// BeforeRequest is called before the request is performed.
+	BeforeRequest(info *RequestInfo)
+
+	// AfterRequest is called after the request is performed. For
+	// streamed responses BytesIn is -1 if the length is unknown.
+	AfterRequest(info *RequestInfo)
+}
+
+// ObserverFuncs implements the Observer interface with
+// functions. Nil functions are ignored.
+type ObserverFuncs struct {
+	Before func(info *RequestInfo)
+	After  func(info *RequestInfo)
+}
+
+// BeforeRequest implements the Observer interface.
+func (of ObserverFuncs) BeforeRequest(info *RequestInfo) {
+	if of.Before != nil {
+		of.Before(info)
+	}
+}
+
+// AfterRequest implements the Observer interface.
+func (of ObserverFuncs) AfterRequest(info *RequestInfo) {
+	if of.After != nil {
+		of.After(info)
+	}
+}
+
+// Observe adds observers to the request. Passed as permanent
+// parameter when opening the database or the server all requests
+// will be observed.
+func Observe(observers ...Observer) Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.observers = append(req.observers, observers...)
+		}
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+// Read implements the io.Reader interface.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+// PathTemplate returns the path with the variable parts like the
+// database, document IDs, or design document names replaced by
+// placeholders, e.g. "/{db}/_design/{ddoc}/_view/{view}". It helps
+// to group requests by endpoint with a low cardinality.
+func PathTemplate(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) == 0 || parts[0] == "" {
+		return "/"
+	}
+	template := []string{}
+	if strings.HasPrefix(parts[0], "_") && !isSystemDatabase(parts[0]) {
+		// Server endpoint, only the node name and values like
+		// configuration sections and keys are variable.
+		template = append(template, parts[0])
+		for i, part := range parts[1:] {
+			switch {
+			case i == 0 && parts[0] == "_node":
+				template = append(template, "{node}")
+			case strings.HasPrefix(part, "_"):
+				template = append(template, part)
+			default:
+				template = append(template, "{name}")
+			}
+		}
+		return "/" + strings.Join(template, "/")
+	}
+	if isSystemDatabase(parts[0]) {
+		template = append(template, parts[0])
+	} else {
+		template = append(template, "{db}")
+	}
+	template = append(template, databasePathTemplate(parts[1:])...)
+	return "/" + strings.Join(template, "/")
+}
+
+// databasePathTemplate returns the template for the
+// parts of a path inside a database.
+func databasePathTemplate(parts []string) []string {
+	if len(parts) == 0 {
+		return nil
+	}
+	template := []string{}
+	switch parts[0] {
+	case "_design":
+		template = append(template, "_design")
+		if len(parts) > 1 {
+			template = append(template, "{ddoc}")
+		}
+		if len(parts) > 2 {
+			if strings.HasPrefix(parts[2], "_") {
+				template = append(template, parts[2])
+				for range parts[3:] {
+					template = append(template, "{name}")
+				}
+			} else {
+				template = append(template, "{attachment}")
+			}
+		}
+	case "_local":
+		template = append(template, "_local")
+		if len(parts) > 1 {
+			template = append(template, "{docid}")
+		}
+	case "_compact":
+		template = append(template, "_compact")
+		if len(parts) > 1 {
+			template = append(template, "{ddoc}")
+		}
+	case "_partition":
+		template = append(template, "_partition")
+		if len(parts) > 1 {
+			template = append(template, "{partition}")
+		}
+		if len(parts) > 2 {
+			template = append(template, databasePathTemplate(parts[2:])...)
+		}
+	default:
+		if strings.HasPrefix(parts[0], "_") {
+			template = append(template, parts[0])
+			for _, part := range parts[1:] {
+				if strings.HasPrefix(part, "_") {
+					template = append(template, part)
+				} else {
+					template = append(template, "{name}")
+				}
+			}
+		} else {
+			template = append(template, "{docid}")
+			if len(parts) > 1 {
+				template = append(template, "{attachment}")
+			}
+		}
+	}
+	return template
+}
+
+// isSystemDatabase checks if the name is one of the
+// system databases.
+func isSystemDatabase(name string) bool {
+	switch name {
+	case "_users", "_replicator", "_global_changes":
+		return true
+	}
+	return false
+}
+
+// EOF
@@ -11,6 +11,10 @@ package couchdb
 // IMPORTS
 //--------------------
 
+import (
+	"net/http"
+)
+
 //--------------------
 // PARAMETERIZABLE
 //--------------------
@@ -68,4 +72,45 @@ func Revision(revision string) Parameter {
 	}
 }
 
+// Client sets the HTTP client used for the requests. Passed as
+// permanent parameter when opening the database all requests
+// will use it, e.g. to share an own connection pool.
+func Client(client *http.Client) Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.client = client
+		}
+	}
+}
+
+// Transport sets the round tripper used for the requests. It's a
+// shortcut for passing a client only containing this transport.
+func Transport(transport http.RoundTripper) Parameter {
+	return Client(&http.Client{
+		Transport: transport,
+	})
+}
+
+// Retry sets the policy for retrying failed requests. Passed as
+// permanent parameter when opening the database it's used for
+// all requests, a nil policy disables retries.
+func Retry(policy *RetryPolicy) Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.retry = policy
+		}
+	}
+}
+
+// Streaming lets the request keep the body of a successful response
+// open instead of reading it completely into memory. It can be read
+// incrementally with ResultSet.RowsDo() and has to be closed.
+func Streaming() Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.stream = true
+		}
+	}
+}
+
 // EOF
@@ -0,0 +1,176 @@
+// Tideland GoCouch - CouchDB - Partitions
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// PARTITION TYPES
+//--------------------
+
+// PartitionInfo contains the information about a partition
+// of a partitioned database.
+type PartitionInfo struct {
+	DatabaseName         string
+	Partition            string
+	DocumentCount        int
+	DeletedDocumentCount int
+	Sizes                DatabaseSizes
+}
+
+//--------------------
+// COUCHDB PARTITION METHODS
+//--------------------
+
+// PartitionPath implements the CouchDB interface.
+func (cdb *couchdb) PartitionPath(partition string, parts ...string) string {
+	return cdb.DatabasePath(append([]string{"_partition", partition}, parts...)...)
+}
+
+// ReadPartitionInfo implements the CouchDB interface.
+func (cdb *couchdb) ReadPartitionInfo(partition string, params ...Parameter) (*PartitionInfo, error) {
+	rs := cdb.Get(cdb.PartitionPath(partition), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	info := couchdbPartitionInfo{}
+	if err := rs.Document(&info); err != nil {
+		return nil, err
+	}
+	return &PartitionInfo{
+		DatabaseName:         info.DatabaseName,
+		Partition:            info.Partition,
+		DocumentCount:        info.DocumentCount,
+		DeletedDocumentCount: info.DeletedDocumentCount,
+		Sizes:                info.Sizes,
+	}, nil
+}
+
+// AllPartitionDocumentsDo implements the CouchDB interface.
+func (cdb *couchdb) AllPartitionDocumentsDo(partition string, process DocumentProcessor, params ...Parameter) error {
+	params = append(params, Streaming())
+	rs := cdb.GetOrPost(cdb.PartitionPath(partition, "_all_docs"), nil, params...)
+	return rs.RowsDo("rows", nil, func(raw json.RawMessage) error {
+		row := couchdbAllDocumentsRow{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		var document Unmarshable
+		if row.Document != nil {
+			document = NewUnmarshableJSON(row.Document)
+		}
+		return process(row.ID, row.Value.Revision, document)
+	})
+}
+
+// IsPartitioned implements the CouchDB interface. A failed detection
+// is cached too and only repeated after a minute, except it failed
+// due to the context.
+func (cdb *couchdb) IsPartitioned() (bool, error) {
+	cdb.features.mu.Lock()
+	p, ok := cdb.features.partitioned[cdb.database]
+	cdb.features.mu.Unlock()
+	if ok && (p.err == nil || time.Since(p.detected) < failedFeatureRetry) {
+		return p.partitioned, p.err
+	}
+	p = partitioning{
+		detected: time.Now(),
+	}
+	info, err := cdb.ReadDatabaseInfo()
+	if err != nil {
+		if cdb.Context().Err() != nil {
+			return false, err
+		}
+		p.err = err
+	} else {
+		p.partitioned = info.Partitioned
+	}
+	cdb.features.mu.Lock()
+	if cdb.features.partitioned == nil {
+		cdb.features.partitioned = map[string]partitioning{}
+	}
+	cdb.features.partitioned[cdb.database] = p
+	cdb.features.mu.Unlock()
+	return p.partitioned, p.err
+}
+
+// forgetPartitioned removes the cached partitioning of the
+// database after creating or deleting it.
+func (cdb *couchdb) forgetPartitioned() {
+	cdb.features.mu.Lock()
+	defer cdb.features.mu.Unlock()
+	delete(cdb.features.partitioned, cdb.database)
+}
+
+// checkPartitionedID checks if the ID has the shape partition:docid
+// in case of a partitioned database. Design and local documents
+// are global. If the partitioning cannot be read the check is left
+// to the server.
+func checkPartitionedID(cdb CouchDB, id string) error {
+	if strings.HasPrefix(id, "_design/") || strings.HasPrefix(id, LocalPrefix) {
+		return nil
+	}
+	partitioned, err := cdb.IsPartitioned()
+	if err != nil || !partitioned {
+		return nil
+	}
+	if !IsPartitionedID(id) {
+		return errors.New(ErrInvalidPartition, errorMessages, id)
+	}
+	return nil
+}
+
+//--------------------
+// PARAMETERS
+//--------------------
+
+// Partitioned lets CreateDatabase() create a partitioned database.
+func Partitioned() Parameter {
+	return func(pa Parameterizable) {
+		pa.SetQuery("partitioned", "true")
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// PartitionedID returns the document ID for a partition.
+func PartitionedID(partition, id string) string {
+	return partition + ":" + id
+}
+
+// IsPartitionedID checks if the document ID has the shape
+// partition:docid. The partition must not start with an
+// underscore.
+func IsPartitionedID(id string) bool {
+	partition, docid, ok := strings.Cut(id, ":")
+	return ok && partition != "" && docid != "" && !strings.HasPrefix(partition, "_")
+}
+
+// PartitionOf returns the partition of the document ID or an
+// empty string if the ID is not partitioned.
+func PartitionOf(id string) string {
+	if !IsPartitionedID(id) {
+		return ""
+	}
+	partition, _, _ := strings.Cut(id, ":")
+	return partition
+}
+
+// EOF
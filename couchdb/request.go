@@ -13,13 +13,15 @@ package couchdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/tideland/golib/errors"
-	"github.com/tideland/golib/logger"
 )
 
 //--------------------
@@ -32,25 +34,43 @@ import (
 
 // request is responsible for an individual request to a CouchDB.
 type request struct {
-	cdb       *couchdb
+	srv       *server
+	ctx       context.Context
 	path      string
 	doc       interface{}
 	docReader io.Reader
 	query     url.Values
 	header    http.Header
+	client    *http.Client
+	retry     *RetryPolicy
+	stream    bool
+	observers []Observer
+
+	logger       Logger
+	logBodyLimit int
+	body         []byte
+
+	writeBack bool
+	target    interface{}
 }
 
 // newRequest creates a new request for the given location, method, and path. If needed
 // query and header can be added like newRequest().setQuery().setHeader.do().
-func newRequest(cdb *couchdb, path string, doc interface{}) *request {
+func newRequest(srv *server, path string, doc interface{}) *request {
 	req := &request{
-		cdb:    cdb,
+		srv:    srv,
+		ctx:    srv.ctx,
+		retry:  srv.retry,
 		path:   path,
 		doc:    doc,
+		target: doc,
 		query:  url.Values{},
 		header: http.Header{},
 	}
-	req.apply(cdb.parameters...)
+	if srv.debugLog {
+		req.logger = golibLogger{}
+	}
+	req.apply(srv.parameters...)
 	return req
 }
 
@@ -94,59 +114,199 @@ func (req *request) get() *resultSet {
 
 // put performs a PUT request.
 func (req *request) put() *resultSet {
-	return req.do(http.MethodPut)
+	return req.writeBackIdentity(req.do(http.MethodPut))
 }
 
 // post performs a POST request.
 func (req *request) post() *resultSet {
-	return req.do(http.MethodPost)
+	return req.writeBackIdentity(req.do(http.MethodPost))
 }
 
 // delete performs a DELETE request.
 func (req *request) delete() *resultSet {
-	return req.do(http.MethodDelete)
+	return req.writeBackIdentity(req.do(http.MethodDelete))
 }
 
-// do performs a request.
+// do performs a request. In case of a retry policy failed
+// attempts are repeated as long as allowed.
 func (req *request) do(method string) *resultSet {
 	// Prepare URL.
 	u := &url.URL{
-		Scheme: "http",
-		Host:   req.cdb.host,
+		Scheme: req.srv.scheme,
+		Host:   req.srv.host,
 		Path:   req.path,
 	}
 	if len(req.query) > 0 {
 		u.RawQuery = req.query.Encode()
 	}
 	// Marshal a potential document.
+	var marshalled []byte
 	if req.doc != nil {
-		marshalled, err := json.Marshal(req.doc)
+		var err error
+		marshalled, err = json.Marshal(req.doc)
 		if err != nil {
 			return newResultSet(nil, errors.Annotate(err, ErrMarshallingDoc, errorMessages))
 		}
-		req.docReader = bytes.NewBuffer(marshalled)
+	}
+	// Perform the attempts. A directly set document reader
+	// cannot be read twice, so here no retry is possible.
+	retry := req.retry
+	if marshalled == nil && req.docReader != nil {
+		retry = nil
+	}
+	req.body = marshalled
+	for attempt := 1; ; attempt++ {
+		if marshalled != nil {
+			req.docReader = bytes.NewReader(marshalled)
+		}
+		rs := req.perform(method, u, attempt)
+		delay, ok := retry.delay(method, attempt, rs)
+		if !ok {
+			return rs
+		}
+		if req.logger != nil {
+			req.logger.LogRequest(&LogEntry{
+				Message:  fmt.Sprintf("couchdb request retried in %v", delay),
+				Method:   method,
+				Path:     req.path,
+				Query:    redactQuery(u.RawQuery),
+				Attempt:  attempt,
+				Duration: delay,
+				Error:    rs.Error(),
+			})
+		}
+		if !sleep(req.ctx, delay) {
+			return rs
+		}
+	}
+}
+
+// perform performs one attempt of a request and lets
+// the observers watch it.
+func (req *request) perform(method string, u *url.URL, attempt int) *resultSet {
+	ctx := req.ctx
+	header := req.header
+	var info *RequestInfo
+	var counter *countingReader
+	if len(req.observers) > 0 {
+		info = &RequestInfo{
+			Context:  ctx,
+			Method:   method,
+			Path:     req.path,
+			Template: PathTemplate(req.path),
+			Attempt:  attempt,
+			Header:   header.Clone(),
+		}
+		for _, observer := range req.observers {
+			observer.BeforeRequest(info)
+		}
+		ctx = info.Context
+		header = info.Header
+		if req.docReader != nil {
+			counter = &countingReader{
+				reader: req.docReader,
+			}
+			req.docReader = counter
+		}
+	}
+	start := time.Now()
+	rs := req.performHTTP(ctx, method, u, header)
+	duration := time.Since(start)
+	rs.attempts = attempt
+	rs.method = method
+	rs.path = req.path
+	if req.logger != nil {
+		req.log(u, header, attempt, duration, rs)
+	}
+	if info != nil {
+		info.Duration = duration
+		info.StatusCode = rs.responseStatus()
+		if counter != nil {
+			info.BytesOut = counter.count
+		}
+		if rs.streamed {
+			info.BytesIn = rs.length
+		} else {
+			info.BytesIn = int64(len(rs.body))
+		}
+		info.Error = rs.Error()
+		for i := len(req.observers) - 1; i >= 0; i-- {
+			req.observers[i].AfterRequest(info)
+		}
+	}
+	return rs
+}
+
+// log passes the entry for one attempt to the logger.
+func (req *request) log(u *url.URL, header http.Header, attempt int, duration time.Duration, rs *resultSet) {
+	entry := &LogEntry{
+		Message:    "couchdb request",
+		Method:     rs.method,
+		Path:       req.path,
+		Query:      redactQuery(u.RawQuery),
+		Attempt:    attempt,
+		StatusCode: rs.responseStatus(),
+		Duration:   duration,
+		RequestID:  rs.Header("X-Couch-Request-ID"),
+		Header:     redactHeader(header),
+		Error:      rs.Error(),
+	}
+	if req.logBodyLimit > 0 {
+		entry.RequestBody = redactBody(req.path, req.body, req.logBodyLimit)
+		if !rs.streamed {
+			entry.ResponseBody = redactBody(req.path, rs.body, req.logBodyLimit)
+		}
+	}
+	req.logger.LogRequest(entry)
+}
+
+// performHTTP performs the HTTP request with the given context
+// and header. The configured timeout covers the whole request
+// including the reading of the response. Streamed requests like
+// feeds or large results are excluded.
+func (req *request) performHTTP(ctx context.Context, method string, u *url.URL, header http.Header) *resultSet {
+	httpCtx := ctx
+	if req.srv.timeout > 0 && !req.stream {
+		var cancel context.CancelFunc
+		httpCtx, cancel = context.WithTimeout(ctx, req.srv.timeout)
+		defer cancel()
 	}
 	// Prepare HTTP request.
-	httpReq, err := http.NewRequest(method, u.String(), req.docReader)
+	httpReq, err := http.NewRequestWithContext(httpCtx, method, u.String(), req.docReader)
 	if err != nil {
 		return newResultSet(nil, errors.Annotate(err, ErrPreparingRequest, errorMessages))
 	}
-	httpReq.Close = true
-	if len(req.header) > 0 {
-		httpReq.Header = req.header
+	if len(header) > 0 {
+		httpReq.Header = header.Clone()
+	}
+	if httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", "application/json")
 	}
-	httpReq.Header.Add("Content-Type", "application/json")
-	httpReq.Header.Add("Accept", "application/json")
-	// Log if wanted.
-	if req.cdb.debugLog {
-		logger.Debugf("couchdb request '%s %s'", method, u)
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json")
 	}
 	// Perform HTTP request.
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	client := req.client
+	if client == nil {
+		client = req.srv.client
+	}
+	httpResp, err := client.Do(httpReq)
 	if err != nil {
+		if ctx.Err() != nil {
+			return newResultSet(nil, errors.Annotate(err, ErrCancelled, errorMessages))
+		}
 		return newResultSet(nil, errors.Annotate(err, ErrPerformingRequest, errorMessages))
 	}
-	return newResultSet(httpResp, nil)
+	var rs *resultSet
+	if req.stream {
+		rs = newStreamedResultSet(httpResp)
+	} else {
+		rs = newResultSet(httpResp, nil)
+	}
+	if rs.err != nil && ctx.Err() != nil {
+		rs.err = errors.Annotate(rs.err, ErrCancelled, errorMessages)
+	}
+	return rs
 }
 
 // EOF
@@ -12,7 +12,9 @@ package couchdb
 //--------------------
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 
@@ -48,6 +50,10 @@ const (
 // RESULT SET
 //--------------------
 
+// RowProcessor is a function processing one raw row of a
+// result set.
+type RowProcessor func(row json.RawMessage) error
+
 // ResultSet contains the server result set.
 type ResultSet interface {
 	// IsOK checks the status code if the result is okay.
@@ -77,12 +83,40 @@ type ResultSet interface {
 
 	// Header provides access to header variables.
 	Header(key string) string
+
+	// Attempts returns the number of attempts needed for
+	// the request in case of a retry policy.
+	Attempts() int
+
+	// IsStreamed returns true if the body of the response is
+	// not read in advance but streamed.
+	IsStreamed() bool
+
+	// RowsDo decodes the elements of the array field with the
+	// given name one by one and passes them to the processor.
+	// All other fields are unmarshalled into head if it's not
+	// nil. A streamed body is read incrementally and closed
+	// afterwards, also early if the processor returns an error.
+	RowsDo(field string, head interface{}, process RowProcessor) error
+
+	// Stream returns the body for an own decoding, e.g. of
+	// a continuous feed. A streamed body is returned only
+	// once and has to be closed by the caller.
+	Stream() (io.ReadCloser, error)
+
+	// Close closes the body of a streamed result set if it
+	// hasn't been read.
+	Close() error
 }
 
 // resultSet implements the ResultSet interface.
 type resultSet struct {
 	statusCode  int
+	responded   bool
 	body        []byte
+	streamed    bool
+	stream      io.ReadCloser
+	length      int64
 	headers     map[string]string
 	document    map[string]interface{}
 	id          string
@@ -91,6 +125,9 @@ type resultSet struct {
 	errorText   string
 	errorReason string
 	err         error
+	attempts    int
+	method      string
+	path        string
 }
 
 // newResultSet analyzes the HTTP response and creates a the
@@ -107,11 +144,14 @@ func newResultSet(resp *http.Response, err error) *resultSet {
 		rs.statusCode = StatusBadRequest
 	case err != nil && errors.IsError(err, ErrPerformingRequest):
 		rs.statusCode = StatusBadRequest
+	case err != nil && errors.IsError(err, ErrCancelled):
+		rs.statusCode = StatusBadRequest
 	case err != nil:
 		rs.statusCode = StatusInternalServerError
 	case resp != nil:
 		// Get status code.
 		rs.statusCode = resp.StatusCode
+		rs.responded = true
 		// Read body.
 		defer resp.Body.Close()
 		body, err := ioutil.ReadAll(resp.Body)
@@ -120,16 +160,40 @@ func newResultSet(resp *http.Response, err error) *resultSet {
 		}
 		rs.body = body
 		// Read headers.
-		rs.headers = make(map[string]string)
-		for key, values := range resp.Header {
-			if len(values) > 0 {
-				rs.headers[key] = values[0]
-			}
-		}
+		rs.headers = readHeaders(resp)
+	}
+	return rs
+}
+
+// newStreamedResultSet creates a ResultSet for a response where
+// the body in case of success is not read. It is kept open as
+// stream for reading and closing by the receiver.
+func newStreamedResultSet(resp *http.Response) *resultSet {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newResultSet(resp, nil)
+	}
+	rs := &resultSet{
+		statusCode: resp.StatusCode,
+		responded:  true,
+		streamed:   true,
+		stream:     resp.Body,
+		length:     resp.ContentLength,
+		headers:    readHeaders(resp),
 	}
 	return rs
 }
 
+// responseStatus returns the status code of the HTTP response
+// or 0 if the request failed without one, e.g. due to network
+// errors or cancellations. In these cases the status code of the
+// result set is only a synthetic one.
+func (rs *resultSet) responseStatus() int {
+	if !rs.responded {
+		return 0
+	}
+	return rs.statusCode
+}
+
 // IsOK implements the ResultSet interface.
 func (rs *resultSet) IsOK() bool {
 	return rs.err == nil && (rs.statusCode >= 200 && rs.statusCode <= 299)
@@ -148,10 +212,18 @@ func (rs *resultSet) Error() error {
 	if rs.err != nil {
 		return rs.err
 	}
-	if err := rs.readDocument(); err != nil {
-		return err
+	// Responses without a body like those to HEAD requests
+	// still return a request error.
+	rs.readDocument()
+	reqErr := &RequestError{
+		Method:     rs.method,
+		Path:       rs.path,
+		StatusCode: rs.statusCode,
+		ErrorText:  rs.errorText,
+		Reason:     rs.errorReason,
+		RequestID:  rs.Header("X-Couch-Request-ID"),
 	}
-	return errors.New(ErrClientRequest, errorMessages, rs.statusCode, rs.errorText, rs.errorReason)
+	return errors.Annotate(reqErr, ErrClientRequest, errorMessages, rs.statusCode, rs.errorText, rs.errorReason)
 }
 
 // ID implements the ResultSet interface.
@@ -189,8 +261,8 @@ func (rs *resultSet) IsDeleted() bool {
 
 // Document implements the ResultSet interface.
 func (rs *resultSet) Document(value interface{}) error {
-	if rs.err != nil {
-		return rs.err
+	if err := rs.readStream(); err != nil {
+		return err
 	}
 	err := json.Unmarshal(rs.body, value)
 	if err != nil {
@@ -201,18 +273,96 @@ func (rs *resultSet) Document(value interface{}) error {
 
 // Raw implements the ResultSet interface.
 func (rs *resultSet) Raw() ([]byte, error) {
-	return rs.body, rs.err
+	if err := rs.readStream(); err != nil {
+		return nil, err
+	}
+	return rs.body, nil
 }
 
 // Header implements the ResultSet interface.
 func (rs *resultSet) Header(key string) string {
-	value, ok := rs.headers[key]
+	value, ok := rs.headers[http.CanonicalHeaderKey(key)]
 	if !ok {
 		return ""
 	}
 	return value
 }
 
+// Attempts implements the ResultSet interface.
+func (rs *resultSet) Attempts() int {
+	return rs.attempts
+}
+
+// IsStreamed implements the ResultSet interface.
+func (rs *resultSet) IsStreamed() bool {
+	return rs.streamed
+}
+
+// RowsDo implements the ResultSet interface.
+func (rs *resultSet) RowsDo(field string, head interface{}, process RowProcessor) error {
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	var r io.Reader
+	switch {
+	case rs.stream != nil:
+		defer rs.Close()
+		r = rs.stream
+	case rs.streamed && rs.body == nil:
+		return errors.New(ErrStreamConsumed, errorMessages)
+	default:
+		r = bytes.NewReader(rs.body)
+	}
+	return decodeRows(json.NewDecoder(r), field, head, process)
+}
+
+// Stream implements the ResultSet interface.
+func (rs *resultSet) Stream() (io.ReadCloser, error) {
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	switch {
+	case rs.stream != nil:
+		stream := rs.stream
+		rs.stream = nil
+		return stream, nil
+	case rs.streamed && rs.body == nil:
+		return nil, errors.New(ErrStreamConsumed, errorMessages)
+	}
+	return ioutil.NopCloser(bytes.NewReader(rs.body)), nil
+}
+
+// Close implements the ResultSet interface.
+func (rs *resultSet) Close() error {
+	if rs.stream == nil {
+		return nil
+	}
+	stream := rs.stream
+	rs.stream = nil
+	return stream.Close()
+}
+
+// readStream reads a not yet read stream completely
+// into the body.
+func (rs *resultSet) readStream() error {
+	if rs.err != nil {
+		return rs.err
+	}
+	if rs.stream == nil {
+		if rs.streamed && rs.body == nil {
+			return errors.New(ErrStreamConsumed, errorMessages)
+		}
+		return nil
+	}
+	defer rs.Close()
+	body, err := ioutil.ReadAll(rs.stream)
+	if err != nil {
+		return errors.Annotate(err, ErrReadingResponseBody, errorMessages)
+	}
+	rs.body = body
+	return nil
+}
+
 // readDocument lazily loads and analyzis a generic document.
 func (rs *resultSet) readDocument() error {
 	if rs.document == nil {
@@ -243,4 +393,77 @@ func (rs *resultSet) readDocument() error {
 	return nil
 }
 
+//--------------------
+// HELPERS
+//--------------------
+
+// readHeaders reads the first values of the response headers.
+func readHeaders(resp *http.Response) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range resp.Header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	return headers
+}
+
+// decodeRows reads a JSON object with the decoder. The elements of
+// the array field are passed one by one to the processor, all other
+// fields are unmarshalled into head as soon as they are read.
+func decodeRows(dec *json.Decoder, field string, head interface{}, process RowProcessor) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		key, _ := token.(string)
+		if key == field {
+			if err := expectDelim(dec, '['); err != nil {
+				return err
+			}
+			for dec.More() {
+				var row json.RawMessage
+				if err := dec.Decode(&row); err != nil {
+					return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+				}
+				if err := process(row); err != nil {
+					return err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return err
+			}
+			continue
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		if head != nil {
+			single, _ := json.Marshal(map[string]json.RawMessage{key: value})
+			if err := json.Unmarshal(single, head); err != nil {
+				return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+			}
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token and checks if it's
+// the expected delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+	}
+	if token != delim {
+		return errors.New(ErrUnexpectedToken, errorMessages, token, delim)
+	}
+	return nil
+}
+
 // EOF
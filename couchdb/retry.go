@@ -0,0 +1,185 @@
+// Tideland GoCouch - CouchDB - Retry
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/etc"
+)
+
+//--------------------
+// RETRY POLICY
+//--------------------
+
+// RetryPolicy defines if and how requests failing with connection
+// errors or transient status codes are retried. Its fields are
+// read-only after passing it to the Retry() parameter.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts including
+	// the first one.
+	Attempts int
+
+	// InitialDelay is the delay before the first retry. It
+	// grows with each further attempt by the Multiplier.
+	InitialDelay time.Duration
+
+	// MaxDelay limits the growing of the delay. Requests whose
+	// response asks with Retry-After for a longer delay are not
+	// retried.
+	MaxDelay time.Duration
+
+	// Multiplier is the factor the delay grows with.
+	Multiplier float64
+
+	// Jitter is the fraction (0.0 to 1.0) the delay is randomly
+	// varied with to avoid many clients retrying at once.
+	Jitter float64
+
+	// StatusCodes contains the response status codes which
+	// are retried.
+	StatusCodes []int
+
+	// Methods contains the HTTP methods which are retried. The
+	// non-idempotent POST should only be added if the requests
+	// can be performed multiple times safely.
+	Methods []string
+}
+
+// NewRetryPolicy returns a retry policy with the given maximum
+// of attempts and default values for all other settings. These
+// are an exponential backoff starting with 100ms up to 5s with
+// a jitter of 20%, the status codes 429, 502, 503, and 504, and
+// the methods HEAD, GET, PUT, and DELETE.
+func NewRetryPolicy(attempts int) *RetryPolicy {
+	return &RetryPolicy{
+		Attempts:     attempts,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     5 * time.Second,
+		Multiplier:   2.0,
+		Jitter:       0.2,
+		StatusCodes: []int{
+			StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		Methods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPut,
+			http.MethodDelete,
+		},
+	}
+}
+
+// newConfiguredRetryPolicy reads the retry policy out of the
+// configuration. Without retry section or less than two attempts
+// nil is returned, so that requests are not retried.
+func newConfiguredRetryPolicy(cfg etc.Etc) *RetryPolicy {
+	attempts := cfg.ValueAsInt("retry/attempts", 1)
+	if attempts < 2 {
+		return nil
+	}
+	rp := NewRetryPolicy(attempts)
+	rp.InitialDelay = cfg.ValueAsDuration("retry/initial-delay", rp.InitialDelay)
+	rp.MaxDelay = cfg.ValueAsDuration("retry/max-delay", rp.MaxDelay)
+	if cfg.ValueAsBool("retry/post", false) {
+		rp.Methods = append(rp.Methods, http.MethodPost)
+	}
+	return rp
+}
+
+// delay checks if the result of the given attempt has to be
+// retried and returns the delay before the next one.
+func (rp *RetryPolicy) delay(method string, attempt int, rs *resultSet) (time.Duration, bool) {
+	if rp == nil || attempt >= rp.Attempts || !rp.retries(method, rs) {
+		return 0, false
+	}
+	delay := float64(rp.InitialDelay) * math.Pow(rp.Multiplier, float64(attempt-1))
+	if rp.MaxDelay > 0 && delay > float64(rp.MaxDelay) {
+		delay = float64(rp.MaxDelay)
+	}
+	if rp.Jitter > 0 {
+		delay += delay * rp.Jitter * (2*rand.Float64() - 1)
+	}
+	if retryAfter := parseRetryAfter(rs.Header("Retry-After")); retryAfter > time.Duration(delay) {
+		if rp.MaxDelay > 0 && retryAfter > rp.MaxDelay {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+	return time.Duration(delay), true
+}
+
+// retries checks if method and result of a request allow a retry.
+func (rp *RetryPolicy) retries(method string, rs *resultSet) bool {
+	allowed := false
+	for _, m := range rp.Methods {
+		if m == method {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	if rs.err != nil {
+		return errors.IsError(rs.err, ErrPerformingRequest)
+	}
+	for _, statusCode := range rp.StatusCodes {
+		if statusCode == rs.statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// parseRetryAfter interprets the Retry-After header which
+// contains seconds or a HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// sleep waits for the given delay and returns false
+// if the context is done before.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// EOF
@@ -0,0 +1,342 @@
+// Tideland GoCouch - CouchDB - Revisions
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// REVISION TYPES
+//--------------------
+
+// RevisionHistory contains the revision history of a document
+// as returned with the Revisions() parameter.
+type RevisionHistory struct {
+	Start int      `json:"start"`
+	IDs   []string `json:"ids"`
+}
+
+// History returns the complete revisions starting with
+// the newest one.
+func (r *RevisionHistory) History() []string {
+	if r == nil {
+		return nil
+	}
+	history := make([]string, len(r.IDs))
+	for i, id := range r.IDs {
+		history[i] = strconv.Itoa(r.Start-i) + "-" + id
+	}
+	return history
+}
+
+// RevisionInfo contains a revision and its status "available",
+// "missing", or "deleted".
+type RevisionInfo struct {
+	Revision string `json:"rev"`
+	Status   string `json:"status"`
+}
+
+// RevisionMeta contains the revision related meta fields of a
+// document read with the parameters Revisions(), RevisionsInfo(),
+// Conflicts(), or DeletedConflicts().
+type RevisionMeta struct {
+	ID               string           `json:"_id"`
+	Revision         string           `json:"_rev"`
+	Deleted          bool             `json:"_deleted,omitempty"`
+	Revisions        *RevisionHistory `json:"_revisions,omitempty"`
+	RevisionsInfo    []RevisionInfo   `json:"_revs_info,omitempty"`
+	Conflicts        []string         `json:"_conflicts,omitempty"`
+	DeletedConflicts []string         `json:"_deleted_conflicts,omitempty"`
+}
+
+// RevisionBranch is one branch of a revision tree from its
+// leaf revision back to the oldest known revision.
+type RevisionBranch struct {
+	Leaf    string
+	Deleted bool
+	History []string
+}
+
+// RevisionTree contains all branches of the revisions of a
+// document. The first one is the winning branch.
+type RevisionTree struct {
+	ID       string
+	Branches []RevisionBranch
+}
+
+// Winner returns the winning revision.
+func (rt *RevisionTree) Winner() string {
+	if len(rt.Branches) == 0 {
+		return ""
+	}
+	return rt.Branches[0].Leaf
+}
+
+// Conflicts returns the not deleted leaf revisions
+// conflicting with the winner.
+func (rt *RevisionTree) Conflicts() []string {
+	conflicts := []string{}
+	for i, branch := range rt.Branches {
+		if i > 0 && !branch.Deleted {
+			conflicts = append(conflicts, branch.Leaf)
+		}
+	}
+	return conflicts
+}
+
+// DocumentVersion is one version of a document
+// identified by its revision.
+type DocumentVersion struct {
+	Revision string
+	Deleted  bool
+	Missing  bool
+	Document Unmarshable
+}
+
+// ConflictResolver merges the versions of a document in conflict.
+// The first version is the current winner. The returned document
+// will be written as new revision of it.
+type ConflictResolver func(versions []DocumentVersion) (interface{}, error)
+
+//--------------------
+// COUCHDB REVISION METHODS
+//--------------------
+
+// ReadRevisionTree implements the CouchDB interface.
+func (cdb *couchdb) ReadRevisionTree(id string, params ...Parameter) (*RevisionTree, error) {
+	params = append(params, OpenRevisions(), Revisions())
+	rs := cdb.ReadDocument(id, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	leaves := []couchdbOpenRevision{}
+	if err := rs.Document(&leaves); err != nil {
+		return nil, err
+	}
+	rt := &RevisionTree{
+		ID: id,
+	}
+	for _, leaf := range leaves {
+		if leaf.OK == nil {
+			continue
+		}
+		meta := RevisionMeta{}
+		if err := json.Unmarshal(leaf.OK, &meta); err != nil {
+			return nil, errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		rt.Branches = append(rt.Branches, RevisionBranch{
+			Leaf:    meta.Revision,
+			Deleted: meta.Deleted,
+			History: meta.Revisions.History(),
+		})
+	}
+	sort.SliceStable(rt.Branches, func(i, j int) bool {
+		return winsOver(rt.Branches[i], rt.Branches[j])
+	})
+	return rt, nil
+}
+
+// ReadConflicts implements the CouchDB interface.
+func (cdb *couchdb) ReadConflicts(id string, params ...Parameter) ([]string, error) {
+	params = append(params, Conflicts())
+	rs := cdb.ReadDocument(id, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	meta := RevisionMeta{}
+	if err := rs.Document(&meta); err != nil {
+		return nil, err
+	}
+	if meta.Conflicts == nil {
+		return []string{}, nil
+	}
+	return meta.Conflicts, nil
+}
+
+// ReadVersions implements the CouchDB interface.
+func (cdb *couchdb) ReadVersions(id string, revisions []string, params ...Parameter) ([]DocumentVersion, error) {
+	rs := cdb.ReadDocument(id, append(params[:len(params):len(params)], OpenRevisions(revisions...))...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	leaves := []couchdbOpenRevision{}
+	if err := rs.Document(&leaves); err != nil {
+		return nil, err
+	}
+	versions := []DocumentVersion{}
+	for _, leaf := range leaves {
+		if leaf.OK == nil {
+			versions = append(versions, DocumentVersion{
+				Revision: leaf.Missing,
+				Missing:  true,
+			})
+			continue
+		}
+		meta := RevisionMeta{}
+		if err := json.Unmarshal(leaf.OK, &meta); err != nil {
+			return nil, errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		versions = append(versions, DocumentVersion{
+			Revision: meta.Revision,
+			Deleted:  meta.Deleted,
+			Document: NewUnmarshableJSON(leaf.OK),
+		})
+	}
+	return versions, nil
+}
+
+// ResolveConflicts implements the CouchDB interface.
+func (cdb *couchdb) ResolveConflicts(id string, resolve ConflictResolver, params ...Parameter) (Statuses, error) {
+	rs := cdb.ReadDocument(id, append(params[:len(params):len(params)], Conflicts())...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	meta := RevisionMeta{}
+	if err := rs.Document(&meta); err != nil {
+		return nil, err
+	}
+	if len(meta.Conflicts) == 0 {
+		return Statuses{}, nil
+	}
+	// Read all versions, the winner first.
+	revisions := append([]string{meta.Revision}, meta.Conflicts...)
+	versions, err := cdb.ReadVersions(id, revisions, params...)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Revision == meta.Revision
+	})
+	merged, err := resolve(versions)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrResolvingConflicts, errorMessages, id)
+	}
+	// Write the merged document as new winner and delete the losers.
+	winner, err := withIDAndRevision(merged, id, meta.Revision)
+	if err != nil {
+		return nil, err
+	}
+	docs := []interface{}{winner}
+	for _, revision := range meta.Conflicts {
+		docs = append(docs, couchdbDeletedDocument{
+			ID:       id,
+			Revision: revision,
+			Deleted:  true,
+		})
+	}
+	return cdb.BulkWriteDocuments(docs, params...)
+}
+
+//--------------------
+// PARAMETERS
+//--------------------
+
+// Revisions lets a read document contain its revision history
+// in the field _revisions.
+func Revisions() Parameter {
+	return func(pa Parameterizable) {
+		pa.SetQuery("revs", "true")
+	}
+}
+
+// RevisionsInfo lets a read document contain the status of its
+// revisions in the field _revs_info.
+func RevisionsInfo() Parameter {
+	return func(pa Parameterizable) {
+		pa.SetQuery("revs_info", "true")
+	}
+}
+
+// Conflicts lets a read document contain its conflicting
+// revisions in the field _conflicts.
+func Conflicts() Parameter {
+	return func(pa Parameterizable) {
+		pa.SetQuery("conflicts", "true")
+	}
+}
+
+// DeletedConflicts lets a read document contain its deleted
+// conflicting revisions in the field _deleted_conflicts.
+func DeletedConflicts() Parameter {
+	return func(pa Parameterizable) {
+		pa.SetQuery("deleted_conflicts", "true")
+	}
+}
+
+// OpenRevisions lets a read return the versions of the document
+// with the given revisions. Without revisions all leaf revisions
+// are returned.
+func OpenRevisions(revisions ...string) Parameter {
+	value := "all"
+	if len(revisions) > 0 {
+		jrevisions, _ := json.Marshal(revisions)
+		value = string(jrevisions)
+	}
+	return func(pa Parameterizable) {
+		pa.SetQuery("open_revs", value)
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// winsOver checks if branch a wins over branch b following the
+// deterministic rules of CouchDB. Not deleted leaves win over
+// deleted ones, then the longer history and finally the higher
+// revision.
+func winsOver(a, b RevisionBranch) bool {
+	if a.Deleted != b.Deleted {
+		return !a.Deleted
+	}
+	aPos, aID := splitRevision(a.Leaf)
+	bPos, bID := splitRevision(b.Leaf)
+	if aPos != bPos {
+		return aPos > bPos
+	}
+	return aID > bID
+}
+
+// splitRevision splits a revision into its position
+// and its ID.
+func splitRevision(revision string) (int, string) {
+	parts := strings.SplitN(revision, "-", 2)
+	if len(parts) != 2 {
+		return 0, revision
+	}
+	pos, _ := strconv.Atoi(parts[0])
+	return pos, parts[1]
+}
+
+// withIDAndRevision returns the document as generic map with
+// the given ID and revision.
+func withIDAndRevision(doc interface{}, id, revision string) (map[string]interface{}, error) {
+	marshalled, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrMarshallingDoc, errorMessages)
+	}
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(marshalled, &fields); err != nil {
+		return nil, errors.Annotate(err, ErrMarshallingDoc, errorMessages)
+	}
+	fields["_id"] = id
+	fields["_rev"] = revision
+	return fields, nil
+}
+
+// EOF
@@ -0,0 +1,520 @@
+// Tideland GoCouch - CouchDB - Server
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/etc"
+	"github.com/tideland/golib/version"
+)
+
+//--------------------
+// SERVER
+//--------------------
+
+// Server provides the access to a CouchDB server. The handles of
+// its databases share the HTTP client, the permanent parameters,
+// and the logging of the server.
+type Server interface {
+	// Path creates a document path starting at root.
+	Path(parts ...string) string
+
+	// Context returns the context used for the requests.
+	Context() context.Context
+
+	// WithContext returns a shallow copy of the Server using the
+	// passed context for all its requests.
+	WithContext(ctx context.Context) Server
+
+	// Database returns the handle of the database with the
+	// given name. It isn't checked if it exists.
+	Database(name string) CouchDB
+
+	// Head performs a HEAD request against the server.
+	Head(path string, doc interface{}, params ...Parameter) ResultSet
+
+	// Get performs a GET request against the server.
+	Get(path string, doc interface{}, params ...Parameter) ResultSet
+
+	// Put performs a PUT request against the server.
+	Put(path string, doc interface{}, params ...Parameter) ResultSet
+
+	// Post performs a POST request against the server.
+	Post(path string, doc interface{}, params ...Parameter) ResultSet
+
+	// Delete performs a DELETE request against the server.
+	Delete(path string, doc interface{}, params ...Parameter) ResultSet
+
+	// GetOrPost decides based on the document if it will perform
+	// a GET request or a POST request.
+	GetOrPost(path string, doc interface{}, params ...Parameter) ResultSet
+
+	// Version returns the version number of the server.
+	Version() (version.Version, error)
+
+	// AllDatabases returns a list of all database IDs
+	// of the server.
+	AllDatabases() ([]string, error)
+
+	// ActiveTasks returns the tasks currently running
+	// on the server.
+	ActiveTasks(params ...Parameter) (Tasks, error)
+
+	// Membership returns the nodes of the cluster.
+	Membership(params ...Parameter) (*Membership, error)
+
+	// Up checks the health of the server. It returns StatusUp or
+	// the reason why the server isn't up, e.g. StatusMaintenanceMode.
+	Up(params ...Parameter) (string, error)
+
+	// ReadStatistics returns the metrics of the node. The name
+	// "_local" addresses the node the server is connected to.
+	// The optional path reads a part of the metrics only.
+	ReadStatistics(node string, path []string, params ...Parameter) (Statistics, error)
+
+	// ReadSystem returns the system metrics of the node.
+	ReadSystem(node string, params ...Parameter) (*System, error)
+
+	// UUIDs returns the given number of UUIDs generated
+	// by the server.
+	UUIDs(count int, params ...Parameter) ([]string, error)
+
+	// Session returns the information about the session
+	// authenticated by the passed parameters.
+	Session(params ...Parameter) (*SessionInfo, error)
+
+	// ReadConfiguration returns the configuration of the node.
+	// The name "_local" addresses the node the server is
+	// connected to.
+	ReadConfiguration(node string, params ...Parameter) (Configuration, error)
+
+	// ReadConfigurationValue returns one value of the
+	// configuration of the node.
+	ReadConfigurationValue(node, section, key string, params ...Parameter) (string, error)
+
+	// WriteConfigurationValue sets one value of the
+	// configuration of the node.
+	WriteConfigurationValue(node, section, key, value string, params ...Parameter) error
+}
+
+// server implements Server.
+type server struct {
+	ctx        context.Context
+	scheme     string
+	host       string
+	debugLog   bool
+	client     *http.Client
+	timeout    time.Duration
+	retry      *RetryPolicy
+	parameters []Parameter
+	features   *features
+}
+
+// failedFeatureRetry is the interval after which the detection
+// of a feature is repeated if it failed.
+const failedFeatureRetry = time.Minute
+
+// features caches the detected features of the server. It is
+// shared by all copies of the server and its databases. The
+// mutex only protects the fields, requests are done without it.
+type features struct {
+	mu          sync.Mutex
+	bulkGet     *bool
+	partitioned map[string]partitioning
+}
+
+// partitioning contains the detected partitioning of a database
+// or the error of its detection.
+type partitioning struct {
+	partitioned bool
+	err         error
+	detected    time.Time
+}
+
+// OpenServer returns a configured connection to a CouchDB server.
+// Permanent parameters, e.g. for authentication, are possible.
+func OpenServer(cfg etc.Etc, params ...Parameter) (Server, error) {
+	return OpenServerPath(cfg, "", params...)
+}
+
+// OpenServerPath returns a configured connection to a CouchDB server.
+// The configuration is part of a larger configuration and the path
+// leads to its location. Permanent parameters, e.g. for authentication,
+// are possible.
+func OpenServerPath(cfg etc.Etc, path string, params ...Parameter) (Server, error) {
+	srv, _, err := openServer(cfg, path, params...)
+	if err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// openServer creates the server and returns it together with
+// its part of the configuration.
+func openServer(cfg etc.Etc, path string, params ...Parameter) (*server, etc.Etc, error) {
+	if cfg == nil {
+		return nil, nil, errors.New(ErrNoConfiguration, errorMessages)
+	}
+	if path != "" {
+		var err error
+		cfg, err = cfg.Split(path)
+		if err != nil {
+			return nil, nil, errors.New(ErrNoConfiguration, errorMessages)
+		}
+	}
+	scheme := cfg.ValueAsString("scheme", SchemeHTTP)
+	defaultPort := 5984
+	switch scheme {
+	case SchemeHTTP:
+	case SchemeHTTPS:
+		defaultPort = 6984
+	default:
+		return nil, nil, errors.New(ErrInvalidScheme, errorMessages, scheme)
+	}
+	// Brackets of IPv6 literals are added when joining.
+	host := net.JoinHostPort(
+		strings.Trim(cfg.ValueAsString("hostname", "localhost"), "[]"),
+		strconv.Itoa(cfg.ValueAsInt("port", defaultPort)),
+	)
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv := &server{
+		ctx:        context.Background(),
+		scheme:     scheme,
+		host:       host,
+		debugLog:   cfg.ValueAsBool("debug-logging", false),
+		client:     client,
+		timeout:    cfg.ValueAsDuration("timeout", 0),
+		retry:      newConfiguredRetryPolicy(cfg),
+		parameters: params,
+		features:   &features{},
+	}
+	return srv, cfg, nil
+}
+
+// Path implements the Server interface.
+func (srv *server) Path(parts ...string) string {
+	return strings.Join(append([]string{""}, parts...), "/")
+}
+
+// Context implements the Server interface.
+func (srv *server) Context() context.Context {
+	return srv.ctx
+}
+
+// WithContext implements the Server interface.
+func (srv *server) WithContext(ctx context.Context) Server {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	csrv := *srv
+	csrv.ctx = ctx
+	return &csrv
+}
+
+// Database implements the Server interface.
+func (srv *server) Database(name string) CouchDB {
+	return &couchdb{
+		server:   *srv,
+		database: name,
+	}
+}
+
+// Head implements the Server interface.
+func (srv *server) Head(path string, doc interface{}, params ...Parameter) ResultSet {
+	req := newRequest(srv, path, doc)
+	return req.apply(params...).head()
+}
+
+// Get implements the Server interface.
+func (srv *server) Get(path string, doc interface{}, params ...Parameter) ResultSet {
+	req := newRequest(srv, path, doc)
+	return req.apply(params...).get()
+}
+
+// Put implements the Server interface.
+func (srv *server) Put(path string, doc interface{}, params ...Parameter) ResultSet {
+	req := newRequest(srv, path, doc)
+	return req.apply(params...).put()
+}
+
+// Post implements the Server interface.
+func (srv *server) Post(path string, doc interface{}, params ...Parameter) ResultSet {
+	req := newRequest(srv, path, doc)
+	return req.apply(params...).post()
+}
+
+// Delete implements the Server interface.
+func (srv *server) Delete(path string, doc interface{}, params ...Parameter) ResultSet {
+	req := newRequest(srv, path, doc)
+	return req.apply(params...).delete()
+}
+
+// GetOrPost implements the Server interface.
+func (srv *server) GetOrPost(path string, doc interface{}, params ...Parameter) ResultSet {
+	var rs ResultSet
+	req := newRequest(srv, path, doc).apply(params...)
+	if req.doc != nil {
+		rs = req.post()
+	} else {
+		rs = req.get()
+	}
+	return rs
+}
+
+// Version implements the Server interface.
+func (srv *server) Version() (version.Version, error) {
+	rs := srv.Get("/", nil)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	welcome := map[string]interface{}{}
+	err := rs.Document(&welcome)
+	if err != nil {
+		return nil, err
+	}
+	vsnstr, ok := welcome["version"].(string)
+	if !ok {
+		return nil, errors.New(ErrInvalidVersion, errorMessages, welcome["version"])
+	}
+	return version.Parse(vsnstr)
+}
+
+// AllDatabases implements the Server interface.
+func (srv *server) AllDatabases() ([]string, error) {
+	rs := srv.Get("/_all_dbs", nil)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	ids := []string{}
+	err := rs.Document(&ids)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ActiveTasks implements the Server interface.
+func (srv *server) ActiveTasks(params ...Parameter) (Tasks, error) {
+	rs := srv.Get(srv.Path("_active_tasks"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	tasks := Tasks{}
+	err := rs.Document(&tasks)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Membership implements the Server interface.
+func (srv *server) Membership(params ...Parameter) (*Membership, error) {
+	rs := srv.Get(srv.Path("_membership"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	membership := Membership{}
+	err := rs.Document(&membership)
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// Up implements the Server interface.
+func (srv *server) Up(params ...Parameter) (string, error) {
+	rs := srv.Get(srv.Path("_up"), nil, params...)
+	if !rs.IsOK() && rs.StatusCode() != StatusNotFound {
+		return "", rs.Error()
+	}
+	up := couchdbUp{}
+	err := rs.Document(&up)
+	if err != nil {
+		return "", err
+	}
+	if up.Status == "" {
+		// Older servers have no health check.
+		return "", rs.Error()
+	}
+	return up.Status, nil
+}
+
+// ReadStatistics implements the Server interface.
+func (srv *server) ReadStatistics(node string, path []string, params ...Parameter) (Statistics, error) {
+	parts := append([]string{"_node", node, "_stats"}, path...)
+	rs := srv.Get(srv.Path(parts...), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	raw, err := rs.Raw()
+	if err != nil {
+		return nil, err
+	}
+	stats := Statistics{}
+	if err = collectMetrics(stats, strings.Join(path, "."), raw); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ReadSystem implements the Server interface.
+func (srv *server) ReadSystem(node string, params ...Parameter) (*System, error) {
+	rs := srv.Get(srv.Path("_node", node, "_system"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	system := System{}
+	err := rs.Document(&system)
+	if err != nil {
+		return nil, err
+	}
+	return &system, nil
+}
+
+// UUIDs implements the Server interface.
+func (srv *server) UUIDs(count int, params ...Parameter) ([]string, error) {
+	if count < 1 {
+		count = 1
+	}
+	params = append(params, Query(KeyValue{"count", strconv.Itoa(count)}))
+	rs := srv.Get(srv.Path("_uuids"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	uuids := couchdbUUIDs{}
+	err := rs.Document(&uuids)
+	if err != nil {
+		return nil, err
+	}
+	return uuids.UUIDs, nil
+}
+
+// Session implements the Server interface.
+func (srv *server) Session(params ...Parameter) (*SessionInfo, error) {
+	rs := srv.Get(srv.Path("_session"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	session := SessionInfo{}
+	err := rs.Document(&session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ReadConfiguration implements the Server interface.
+func (srv *server) ReadConfiguration(node string, params ...Parameter) (Configuration, error) {
+	rs := srv.Get(srv.Path("_node", node, "_config"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	config := Configuration{}
+	err := rs.Document(&config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ReadConfigurationValue implements the Server interface.
+func (srv *server) ReadConfigurationValue(node, section, key string, params ...Parameter) (string, error) {
+	rs := srv.Get(srv.Path("_node", node, "_config", section, key), nil, params...)
+	if !rs.IsOK() {
+		return "", rs.Error()
+	}
+	var value string
+	err := rs.Document(&value)
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// WriteConfigurationValue implements the Server interface.
+func (srv *server) WriteConfigurationValue(node, section, key, value string, params ...Parameter) error {
+	rs := srv.Put(srv.Path("_node", node, "_config", section, key), value, params...)
+	return rs.Error()
+}
+
+// collectMetrics walks the raw statistics and adds the metrics
+// with their dotted names. Groups are recognized by not having
+// a type.
+func collectMetrics(stats Statistics, name string, raw json.RawMessage) error {
+	metric := couchdbMetric{}
+	if err := json.Unmarshal(raw, &metric); err != nil {
+		return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+	}
+	if metric.Type == "" {
+		group := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &group); err != nil {
+			return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+		for subname, value := range group {
+			if name != "" {
+				subname = name + "." + subname
+			}
+			if err := collectMetrics(stats, subname, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m := Metric{
+		Type:        metric.Type,
+		Description: metric.Description,
+	}
+	if metric.Type == "histogram" {
+		m.Histogram = &Histogram{}
+		if err := json.Unmarshal(metric.Value, m.Histogram); err != nil {
+			return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+		}
+	} else if err := json.Unmarshal(metric.Value, &m.Value); err != nil {
+		return errors.Annotate(err, ErrUnmarshallingDoc, errorMessages)
+	}
+	stats[name] = m
+	return nil
+}
+
+// supportsBulkGet checks once if the server supports _bulk_get,
+// which is available since CouchDB 2.0.
+func (srv *server) supportsBulkGet() (bool, error) {
+	srv.features.mu.Lock()
+	bulkGet := srv.features.bulkGet
+	srv.features.mu.Unlock()
+	if bulkGet != nil {
+		return *bulkGet, nil
+	}
+	vsn, err := srv.Version()
+	if err != nil {
+		return false, err
+	}
+	supported := vsn.Major() >= 2
+	srv.features.mu.Lock()
+	srv.features.bulkGet = &supported
+	srv.features.mu.Unlock()
+	return supported, nil
+}
+
+// EOF
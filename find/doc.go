@@ -38,6 +38,12 @@
 //     })
 //
 // More parameters allow restrictions to fields, sorting, filtering, and paging.
+// With the parameter find.Streaming() the documents are decoded while they
+// arrive instead of reading the whole result into memory first.
+//
+// Explain() returns how CouchDB performs a find, e.g. which index it uses.
+// In partitioned databases PartitionFind() and PartitionExplain() work
+// inside one partition.
 package find
 
 // EOF
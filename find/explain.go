@@ -0,0 +1,129 @@
+// Tideland Go CouchDB Client - Find - Explain
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package find
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// EXPLANATION
+//--------------------
+
+// ExplainedIndex describes the index used by a find.
+type ExplainedIndex struct {
+	DesignDocument string
+	Name           string
+	Type           string
+	Fields         []string
+}
+
+// Explanation describes how CouchDB performs a find. Fields
+// is empty if all fields are returned.
+type Explanation struct {
+	Database string
+	Index    ExplainedIndex
+	Selector couchdb.Unmarshable
+	Options  map[string]interface{}
+	Limit    int
+	Skip     int
+	Fields   []string
+}
+
+// Explain returns how CouchDB would perform the find.
+func Explain(cdb couchdb.CouchDB, selector Selector, parameters ...Parameter) (*Explanation, error) {
+	return explain(cdb, cdb.DatabasePath("_explain"), selector, parameters...)
+}
+
+// ExplainContext returns how CouchDB would perform the find
+// using the passed context.
+func ExplainContext(ctx context.Context, cdb couchdb.CouchDB, selector Selector, parameters ...Parameter) (*Explanation, error) {
+	return Explain(cdb.WithContext(ctx), selector, parameters...)
+}
+
+// PartitionExplain returns how CouchDB would perform the find
+// in the partition of a partitioned database.
+func PartitionExplain(cdb couchdb.CouchDB, partition string, selector Selector, parameters ...Parameter) (*Explanation, error) {
+	return explain(cdb, cdb.PartitionPath(partition, "_explain"), selector, parameters...)
+}
+
+// PartitionExplainContext returns how CouchDB would perform the
+// find in the partition of a partitioned database using the
+// passed context.
+func PartitionExplainContext(ctx context.Context, cdb couchdb.CouchDB, partition string, selector Selector, parameters ...Parameter) (*Explanation, error) {
+	return PartitionExplain(cdb.WithContext(ctx), partition, selector, parameters...)
+}
+
+// explain performs the explain command with the given path.
+func explain(cdb couchdb.CouchDB, path string, selector Selector, parameters ...Parameter) (*Explanation, error) {
+	req := newRequest()
+	req.SetParameter("selector", selector)
+	req.apply(parameters...)
+	rs := cdb.Post(path, req)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	resp := explainResponse{}
+	if err := rs.Document(&resp); err != nil {
+		return nil, err
+	}
+	e := &Explanation{
+		Database: resp.Database,
+		Index: ExplainedIndex{
+			DesignDocument: resp.Index.DesignDocument,
+			Name:           resp.Index.Name,
+			Type:           resp.Index.Type,
+		},
+		Selector: couchdb.NewUnmarshableJSON(resp.Selector),
+		Options:  resp.Options,
+		Limit:    resp.Limit,
+		Skip:     resp.Skip,
+	}
+	for _, field := range resp.Index.Definition.Fields {
+		for name := range field {
+			e.Index.Fields = append(e.Index.Fields, name)
+		}
+	}
+	// Fields is the string "all_fields" or a list of fields.
+	json.Unmarshal(resp.Fields, &e.Fields)
+	return e, nil
+}
+
+//--------------------
+// EXPLAIN RESPONSE
+//--------------------
+
+// explainResponse describes the explanation returned by CouchDB.
+type explainResponse struct {
+	Database string                 `json:"dbname"`
+	Index    explainIndex           `json:"index"`
+	Selector json.RawMessage        `json:"selector"`
+	Options  map[string]interface{} `json:"opts"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+	Fields   json.RawMessage        `json:"fields"`
+}
+
+// explainIndex describes the explained index.
+type explainIndex struct {
+	DesignDocument string `json:"ddoc"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Definition     struct {
+		Fields []map[string]string `json:"fields"`
+	} `json:"def"`
+}
+
+// EOF
@@ -12,6 +12,7 @@ package find
 //--------------------
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/tideland/gocouch/couchdb"
@@ -23,12 +24,39 @@ import (
 
 // Find returns access to the found results.
 func Find(cdb couchdb.CouchDB, selector Selector, parameters ...Parameter) ResultSet {
+	return find(cdb, cdb.DatabasePath("_find"), selector, parameters...)
+}
+
+// FindContext returns access to the found results using the
+// passed context.
+func FindContext(ctx context.Context, cdb couchdb.CouchDB, selector Selector, parameters ...Parameter) ResultSet {
+	return Find(cdb.WithContext(ctx), selector, parameters...)
+}
+
+// PartitionFind returns access to the results found in
+// the partition of a partitioned database.
+func PartitionFind(cdb couchdb.CouchDB, partition string, selector Selector, parameters ...Parameter) ResultSet {
+	return find(cdb, cdb.PartitionPath(partition, "_find"), selector, parameters...)
+}
+
+// PartitionFindContext returns access to the results found in
+// the partition of a partitioned database using the passed context.
+func PartitionFindContext(ctx context.Context, cdb couchdb.CouchDB, partition string, selector Selector, parameters ...Parameter) ResultSet {
+	return PartitionFind(cdb.WithContext(ctx), partition, selector, parameters...)
+}
+
+// find performs the find command with the given path.
+func find(cdb couchdb.CouchDB, path string, selector Selector, parameters ...Parameter) ResultSet {
 	// Create request object.
-	req := request{}
+	req := newRequest()
 	req.SetParameter("selector", selector)
 	req.apply(parameters...)
 	// Perform find command.
-	rs := cdb.Post(cdb.DatabasePath("_find"), req)
+	var params []couchdb.Parameter
+	if req.stream {
+		params = append(params, couchdb.Streaming())
+	}
+	rs := cdb.Post(path, req, params...)
 	return newResultSet(rs)
 }
 
@@ -50,12 +78,19 @@ type ResultSet interface {
 	// Error returns a possible error of a request.
 	Error() error
 
-	// Len returns the number of changes.
+	// Len returns the number of changes. In streaming mode
+	// calling it before Do() reads the whole result.
 	Len() int
 
 	// Do iterates over the results of a ResultSet and
-	// processes the content.
+	// processes the content. In streaming mode the documents
+	// are decoded while they arrive and can be iterated
+	// only once.
 	Do(process Processor) error
+
+	// Close closes the result set in streaming mode if the
+	// documents are not iterated.
+	Close() error
 }
 
 // resultSet implements the ResultSet interface.
@@ -63,6 +98,8 @@ type resultSet struct {
 	rs          couchdb.ResultSet
 	response    *response
 	responseErr error
+	streamed    *response
+	returned    int
 }
 
 // newResultSet returns a ResultSet.
@@ -70,12 +107,8 @@ func newResultSet(rs couchdb.ResultSet) ResultSet {
 	frs := &resultSet{
 		rs: rs,
 	}
-	resp := response{}
-	err := frs.rs.Document(&resp)
-	if err != nil {
-		frs.responseErr = err
-	} else {
-		frs.response = &resp
+	if !rs.IsStreamed() {
+		frs.readResponse()
 	}
 	return frs
 }
@@ -100,6 +133,12 @@ func (frs *resultSet) Error() error {
 
 // Len implements ResultSet.
 func (frs *resultSet) Len() int {
+	if frs.streamed != nil {
+		return frs.returned
+	}
+	if frs.response == nil && frs.responseErr == nil {
+		frs.readResponse()
+	}
 	if !frs.IsOK() {
 		return -1
 	}
@@ -108,6 +147,12 @@ func (frs *resultSet) Len() int {
 
 // Do implements ResultSet.
 func (frs *resultSet) Do(process Processor) error {
+	if frs.rs.IsStreamed() && frs.response == nil && frs.responseErr == nil {
+		return frs.streamDo(process)
+	}
+	if !frs.IsOK() {
+		return frs.Error()
+	}
 	for _, doc := range frs.response.Documents {
 		unmarshableDoc := couchdb.NewUnmarshableJSON(doc)
 		if err := process(unmarshableDoc); err != nil {
@@ -117,25 +162,68 @@ func (frs *resultSet) Do(process Processor) error {
 	return nil
 }
 
+// Close implements ResultSet.
+func (frs *resultSet) Close() error {
+	return frs.rs.Close()
+}
+
+// readResponse reads the whole response document.
+func (frs *resultSet) readResponse() {
+	resp := response{}
+	err := frs.rs.Document(&resp)
+	if err != nil {
+		frs.responseErr = err
+	} else {
+		frs.response = &resp
+	}
+}
+
+// streamDo decodes and processes the documents while
+// reading the streamed result.
+func (frs *resultSet) streamDo(process Processor) error {
+	resp := response{}
+	frs.streamed = &resp
+	frs.returned = 0
+	return frs.rs.RowsDo("docs", &resp, func(doc json.RawMessage) error {
+		frs.returned++
+		return process(couchdb.NewUnmarshableJSON(doc))
+	})
+}
+
 //--------------------
 // REQUEST AND RESPONSE
 //--------------------
 
 // request contains all request object fields.
-type request map[string]interface{}
+type request struct {
+	fields map[string]interface{}
+	stream bool
+}
+
+// newRequest creates an empty request.
+func newRequest() *request {
+	return &request{
+		fields: make(map[string]interface{}),
+	}
+}
 
 // SetParameter implements Parameterizable.
-func (req request) SetParameter(key string, parameter interface{}) {
-	req[key] = parameter
+func (req *request) SetParameter(key string, parameter interface{}) {
+	req.fields[key] = parameter
 }
 
 // apply applies a list of parameters to the request.
-func (req request) apply(parameters ...Parameter) {
+func (req *request) apply(parameters ...Parameter) {
 	for _, applyParameterTo := range parameters {
 		applyParameterTo(req)
 	}
 }
 
+// MarshalJSON implements the json.Marshaler interface.
+func (req *request) MarshalJSON() ([]byte, error) {
+	return json.Marshal(req.fields)
+}
+
 // response describes the document returned by CouchDB.
 type response struct {
 	Warning   string            `json:"warning"`
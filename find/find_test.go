@@ -8,6 +8,7 @@
 package find_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -72,6 +73,21 @@ func TestSimpleFind(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestFindError tests the error of a find in a missing database.
+func TestFindError(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareFilledDatabase("find-error", 10, assert)
+	defer cleanup()
+
+	missing := cdb.Server().Database("tgocouch-testing-find-missing")
+	frs := find.Find(missing, find.Select(find.Equal("age", 42)))
+	assert.False(frs.IsOK())
+	reqErr, ok := couchdb.AsRequestError(frs.Error())
+	assert.True(ok)
+	assert.Equal(reqErr.StatusCode, couchdb.StatusNotFound)
+	assert.True(errors.Is(reqErr, couchdb.ErrNotFoundStatus))
+}
+
 // TestLimitedFind tests retrieving a larger number but set the limit.
 func TestLimitedFind(t *testing.T) {
 	assert := audit.NewTestingAssertion(t, true)
@@ -92,6 +108,69 @@ func TestLimitedFind(t *testing.T) {
 	assert.Length(frs, 100)
 }
 
+// TestExplain tests explaining a find.
+func TestExplain(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareFilledDatabase("find-explain", 1000, assert)
+	defer cleanup()
+
+	selector := find.Select(find.Equal("name", "Jack Black"))
+	explanation, err := find.Explain(cdb, selector, find.Fields("name", "age"), find.Limit(5))
+	assert.Nil(err)
+	assert.Equal(explanation.Index.Type, "json")
+	assert.Equal(explanation.Index.Fields, []string{"name"})
+	assert.Equal(explanation.Limit, 5)
+	assert.Equal(explanation.Fields, []string{"name", "age"})
+}
+
+// TestPartitionFind tests finding and explaining inside a partition.
+func TestPartitionFind(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cfgstr := strings.Replace(Cfg, "<<DATABASE>>", "find-partition", 1)
+	cfg, err := etc.ReadString(cfgstr)
+	assert.Nil(err)
+	cdb, err := couchdb.Open(cfg)
+	assert.Nil(err)
+	cdb.DeleteDatabase()
+	rs := cdb.CreateDatabase(couchdb.Partitioned())
+	assert.True(rs.IsOK())
+	defer cdb.DeleteDatabase()
+
+	for i, id := range []string{"eu:1", "eu:2", "us:1"} {
+		rs = cdb.CreateDocument(Person{DocumentID: id, Age: 20 + i})
+		assert.True(rs.IsOK())
+	}
+	frs := find.PartitionFind(cdb, "eu", find.Select(find.GreaterThan("age", 0)))
+	assert.True(frs.IsOK())
+	assert.Length(frs, 2)
+	explanation, err := find.PartitionExplain(cdb, "eu", find.Select(find.GreaterThan("age", 0)))
+	assert.Nil(err)
+	assert.Equal(explanation.Index.Name, "_all_docs")
+}
+
+// TestStreamingFind tests retrieving the found documents in streaming mode.
+func TestStreamingFind(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareFilledDatabase("find-streaming", 1000, assert)
+	defer cleanup()
+
+	selector := find.Select(find.Equal("active", true))
+	frs := find.Find(cdb, selector, find.Fields("name", "active"), find.Limit(100), find.Streaming())
+	assert.True(frs.IsOK())
+	err := frs.Do(func(document couchdb.Unmarshable) error {
+		fields := struct {
+			Active bool `json:"active"`
+		}{}
+		if err := document.Unmarshal(&fields); err != nil {
+			return err
+		}
+		assert.True(fields.Active)
+		return nil
+	})
+	assert.Nil(err)
+	assert.Length(frs, 100)
+}
+
 // TestSortedFind tests retrieving a larger number in a sorted way.
 func TestSortedFind(t *testing.T) {
 	assert := audit.NewTestingAssertion(t, true)
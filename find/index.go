@@ -12,6 +12,8 @@ package find
 //--------------------
 
 import (
+	"context"
+
 	"github.com/tideland/gocouch/couchdb"
 )
 
@@ -46,13 +48,19 @@ func (idx *index) Parameters() []Parameter {
 // Fields is needed while others are optional.
 func CreateIndex(cdb couchdb.CouchDB, index Index) error {
 	// Create request object.
-	idxReq := request{}
+	idxReq := newRequest()
 	idxReq.apply(index.Parameters()...)
-	req := request{}
+	req := newRequest()
 	req.SetParameter("index", idxReq)
 	// Perform index command.
 	rs := cdb.Post(cdb.DatabasePath("_index"), req)
 	return rs.Error()
 }
 
+// CreateIndexContext creates a new index for finds using
+// the passed context.
+func CreateIndexContext(ctx context.Context, cdb couchdb.CouchDB, index Index) error {
+	return CreateIndex(cdb.WithContext(ctx), index)
+}
+
 // EOF
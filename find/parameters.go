@@ -106,6 +106,16 @@ func Stable(stable bool) Parameter {
 	}
 }
 
+// Streaming lets the found documents be decoded while they arrive
+// instead of reading the whole result into memory first.
+func Streaming() Parameter {
+	return func(pa Parameterizable) {
+		if req, ok := pa.(*request); ok {
+			req.stream = true
+		}
+	}
+}
+
 //--------------------
 // DIRECTION
 //--------------------
@@ -0,0 +1,34 @@
+// Tideland Go CouchDB Client - Replication
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package replication of the Tideland Go CouchDB Client helps to
+// replicate databases and to manage persistent replication jobs.
+//
+// Source and target are endpoints with URL and headers. The
+// authentication parameters of package security can be passed
+// to set them.
+//
+//     r := &replication.Replication{
+//         Source:     replication.NewEndpoint("https://eu.example.com/orders"),
+//         Target:     replication.NewEndpoint("https://us.example.com/orders",
+//             security.BasicAuthentication("user", "secret")),
+//         Continuous: true,
+//     }
+//     result, err := replication.Replicate(cdb, r, adminAuth)
+//
+// Filters, document IDs, and selectors of package find restrict the
+// replicated documents. Cancel() stops a running replication.
+//
+// Persistent jobs surviving restarts of the server are documents in
+// the database _replicator. They are created with CreateJob(), listed
+// with ListJobs(), and cancelled with CancelJob(). The scheduler of
+// CouchDB 2.x reports their state, progress, and errors. They are read
+// with ReadSchedulerJobs(), ReadSchedulerDocuments(), and
+// ReadSchedulerDocument().
+package replication
+
+// EOF
@@ -0,0 +1,187 @@
+// Tideland Go CouchDB Client - Replication - Document Types
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package replication
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// EXTERNAL DOCUMENT TYPES
+//--------------------
+
+// Replication describes a replication from a source to a
+// target. The Selector can be created with package find.
+type Replication struct {
+	Source        *Endpoint         `json:"source"`
+	Target        *Endpoint         `json:"target"`
+	Continuous    bool              `json:"continuous,omitempty"`
+	CreateTarget  bool              `json:"create_target,omitempty"`
+	DocumentIDs   []string          `json:"doc_ids,omitempty"`
+	Filter        string            `json:"filter,omitempty"`
+	QueryParams   map[string]string `json:"query_params,omitempty"`
+	Selector      interface{}       `json:"selector,omitempty"`
+	SinceSequence string            `json:"since_seq,omitempty"`
+}
+
+// History contains the statistics of one replication session.
+type History struct {
+	SessionID        string           `json:"session_id"`
+	StartTime        string           `json:"start_time"`
+	EndTime          string           `json:"end_time"`
+	StartLastSeq     couchdb.Sequence `json:"start_last_seq"`
+	EndLastSeq       couchdb.Sequence `json:"end_last_seq"`
+	RecordedSeq      couchdb.Sequence `json:"recorded_seq"`
+	MissingChecked   int              `json:"missing_checked"`
+	MissingFound     int              `json:"missing_found"`
+	DocsRead         int              `json:"docs_read"`
+	DocsWritten      int              `json:"docs_written"`
+	DocWriteFailures int              `json:"doc_write_failures"`
+}
+
+// Result is the result of a replication started with Replicate().
+// One-shot replications return the history, continuous ones
+// the ID of the replication.
+type Result struct {
+	OK                 bool             `json:"ok"`
+	LocalID            string           `json:"_local_id,omitempty"`
+	SessionID          string           `json:"session_id,omitempty"`
+	SourceLastSequence couchdb.Sequence `json:"source_last_seq,omitempty"`
+	NoChanges          bool             `json:"no_changes,omitempty"`
+	History            []History        `json:"history,omitempty"`
+}
+
+// Job is a persistent replication stored in the
+// database _replicator.
+type Job struct {
+	ID          string
+	Revision    string
+	Replication *Replication
+}
+
+// Jobs is a list of persistent replications.
+type Jobs []Job
+
+// Info contains the progress of a replication as reported
+// by the scheduler. In case of a failure Error is set.
+type Info struct {
+	Error                 string           `json:"error,omitempty"`
+	ChangesPending        int              `json:"changes_pending"`
+	CheckpointedSourceSeq couchdb.Sequence `json:"checkpointed_source_seq"`
+	SourceSeq             couchdb.Sequence `json:"source_seq"`
+	ThroughSeq            couchdb.Sequence `json:"through_seq"`
+	DocsRead              int              `json:"docs_read"`
+	DocsWritten           int              `json:"docs_written"`
+	DocWriteFailures      int              `json:"doc_write_failures"`
+	MissingRevisionsFound int              `json:"missing_revisions_found"`
+	RevisionsChecked      int              `json:"revisions_checked"`
+}
+
+// Event is one event in the history of a scheduler job
+// like "added", "started", or "crashed".
+type Event struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// SchedulerJob is a replication job currently
+// handled by the scheduler.
+type SchedulerJob struct {
+	ID         string  `json:"id"`
+	Database   string  `json:"database"`
+	DocumentID string  `json:"doc_id"`
+	Node       string  `json:"node"`
+	PID        string  `json:"pid"`
+	Source     string  `json:"source"`
+	Target     string  `json:"target"`
+	User       string  `json:"user"`
+	StartTime  string  `json:"start_time"`
+	History    []Event `json:"history"`
+	Info       *Info   `json:"info"`
+}
+
+// SchedulerJobs is the list of scheduler jobs.
+type SchedulerJobs []SchedulerJob
+
+// Replication document states reported by the scheduler.
+const (
+	StateInitializing = "initializing"
+	StateError        = "error"
+	StatePending      = "pending"
+	StateRunning      = "running"
+	StateCrashing     = "crashing"
+	StateCompleted    = "completed"
+	StateFailed       = "failed"
+)
+
+// SchedulerDocument is the state of a replication
+// document as reported by the scheduler.
+type SchedulerDocument struct {
+	ID          string `json:"id"`
+	Database    string `json:"database"`
+	DocumentID  string `json:"doc_id"`
+	Node        string `json:"node"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	State       string `json:"state"`
+	ErrorCount  int    `json:"error_count"`
+	StartTime   string `json:"start_time"`
+	LastUpdated string `json:"last_updated"`
+	Info        *Info  `json:"info"`
+}
+
+// SchedulerDocuments is the list of scheduler documents.
+type SchedulerDocuments []SchedulerDocument
+
+//--------------------
+// INTERNAL DOCUMENT TYPES
+//--------------------
+
+// couchdbReplicate is the body of a replication request.
+type couchdbReplicate struct {
+	*Replication
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// couchdbReplicatorDocument is a document of the
+// database _replicator.
+type couchdbReplicatorDocument struct {
+	ID       string `json:"_id"`
+	Revision string `json:"_rev,omitempty"`
+	*Replication
+}
+
+// couchdbReplicatorRows contains the documents of
+// the database _replicator.
+type couchdbReplicatorRows struct {
+	Rows []struct {
+		ID       string                    `json:"id"`
+		Document couchdbReplicatorDocument `json:"doc"`
+	} `json:"rows"`
+}
+
+// couchdbSchedulerJobs is the response when reading
+// the scheduler jobs.
+type couchdbSchedulerJobs struct {
+	TotalRows int           `json:"total_rows"`
+	Jobs      SchedulerJobs `json:"jobs"`
+}
+
+// couchdbSchedulerDocuments is the response when reading
+// the scheduler documents.
+type couchdbSchedulerDocuments struct {
+	TotalRows int                `json:"total_rows"`
+	Documents SchedulerDocuments `json:"docs"`
+}
+
+// EOF
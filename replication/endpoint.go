@@ -0,0 +1,102 @@
+// Tideland Go CouchDB Client - Replication - Endpoint
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package replication
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// ENDPOINT
+//--------------------
+
+// Endpoint is the source or the target of a replication.
+type Endpoint struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// NewEndpoint creates an endpoint for the database with the
+// given URL. The parameters set headers and query, e.g. for
+// the authentication.
+func NewEndpoint(url string, params ...couchdb.Parameter) *Endpoint {
+	ep := &Endpoint{
+		URL: url,
+	}
+	for _, param := range params {
+		param(ep)
+	}
+	return ep
+}
+
+// SetQuery implements the couchdb.Parameterizable interface.
+func (ep *Endpoint) SetQuery(key, value string) {
+	ep.updateQuery(func(query url.Values) {
+		query.Set(key, value)
+	})
+}
+
+// AddQuery implements the couchdb.Parameterizable interface.
+func (ep *Endpoint) AddQuery(key, value string) {
+	ep.updateQuery(func(query url.Values) {
+		query.Add(key, value)
+	})
+}
+
+// SetHeader implements the couchdb.Parameterizable interface.
+func (ep *Endpoint) SetHeader(key, value string) {
+	if ep.Headers == nil {
+		ep.Headers = map[string]string{}
+	}
+	ep.Headers[key] = value
+}
+
+// UpdateDocument implements the couchdb.Parameterizable interface.
+// Endpoints have no document, so it does nothing.
+func (ep *Endpoint) UpdateDocument(update func(interface{}) interface{}) {}
+
+// UnmarshalJSON implements json.Unmarshaler. Endpoints may
+// be stored as simple URLs.
+func (ep *Endpoint) UnmarshalJSON(data []byte) error {
+	var u string
+	if err := json.Unmarshal(data, &u); err == nil {
+		ep.URL = u
+		ep.Headers = nil
+		return nil
+	}
+	type plain Endpoint
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return errors.Annotate(err, ErrInvalidEndpoint, errorMessages)
+	}
+	*ep = Endpoint(p)
+	return nil
+}
+
+// updateQuery changes the query of the URL.
+func (ep *Endpoint) updateQuery(update func(query url.Values)) {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return
+	}
+	query := u.Query()
+	update(query)
+	u.RawQuery = query.Encode()
+	ep.URL = u.String()
+}
+
+// EOF
@@ -0,0 +1,37 @@
+// Tideland Go CouchDB Client - Replication - Errors
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package replication
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes of the package.
+const (
+	ErrNoEndpoint = iota + 1
+	ErrInvalidEndpoint
+	ErrReplicationFailed
+)
+
+// errorMessages contains the messages for the
+// individual error codes.
+var errorMessages = errors.Messages{
+	ErrNoEndpoint:        "replication needs source and target",
+	ErrInvalidEndpoint:   "invalid endpoint",
+	ErrReplicationFailed: "replication failed",
+}
+
+// EOF
@@ -0,0 +1,247 @@
+// Tideland Go CouchDB Client - Replication
+//
+// Copyright (C) 2016-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package replication
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocouch/couchdb"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// ReplicatorDatabase is the database containing the
+// persistent replication jobs.
+const ReplicatorDatabase = "_replicator"
+
+//--------------------
+// REPLICATION FUNCTIONS
+//--------------------
+
+// Replicate starts the replication. One-shot replications return
+// after they are done, continuous ones after they are started.
+func Replicate(cdb couchdb.CouchDB, r *Replication, params ...couchdb.Parameter) (*Result, error) {
+	if err := validate(r); err != nil {
+		return nil, err
+	}
+	req := couchdbReplicate{
+		Replication: r,
+	}
+	rs := cdb.Post(cdb.Path("_replicate"), req, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	result := Result{}
+	err := rs.Document(&result)
+	if err != nil {
+		return nil, err
+	}
+	if !result.OK && !result.NoChanges {
+		return nil, errors.New(ErrReplicationFailed, errorMessages)
+	}
+	return &result, nil
+}
+
+// ReplicateContext starts the replication using the passed context.
+func ReplicateContext(ctx context.Context, cdb couchdb.CouchDB, r *Replication, params ...couchdb.Parameter) (*Result, error) {
+	return Replicate(cdb.WithContext(ctx), r, params...)
+}
+
+// Cancel stops the running replication. It has to be
+// described like when it has been started.
+func Cancel(cdb couchdb.CouchDB, r *Replication, params ...couchdb.Parameter) error {
+	if err := validate(r); err != nil {
+		return err
+	}
+	req := couchdbReplicate{
+		Replication: r,
+		Cancel:      true,
+	}
+	rs := cdb.Post(cdb.Path("_replicate"), req, params...)
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	return nil
+}
+
+// CancelContext stops the running replication using
+// the passed context.
+func CancelContext(ctx context.Context, cdb couchdb.CouchDB, r *Replication, params ...couchdb.Parameter) error {
+	return Cancel(cdb.WithContext(ctx), r, params...)
+}
+
+//--------------------
+// JOB FUNCTIONS
+//--------------------
+
+// CreateJob creates a persistent replication job with
+// the given ID.
+func CreateJob(cdb couchdb.CouchDB, id string, r *Replication, params ...couchdb.Parameter) error {
+	if err := validate(r); err != nil {
+		return err
+	}
+	doc := couchdbReplicatorDocument{
+		ID:          id,
+		Replication: r,
+	}
+	rs := cdb.Put(cdb.Path(ReplicatorDatabase, id), doc, params...)
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	return nil
+}
+
+// CreateJobContext creates a persistent replication job
+// using the passed context.
+func CreateJobContext(ctx context.Context, cdb couchdb.CouchDB, id string, r *Replication, params ...couchdb.Parameter) error {
+	return CreateJob(cdb.WithContext(ctx), id, r, params...)
+}
+
+// CancelJob cancels the persistent replication job with the
+// given ID by deleting its document.
+func CancelJob(cdb couchdb.CouchDB, id string, params ...couchdb.Parameter) error {
+	path := cdb.Path(ReplicatorDatabase, id)
+	rs := cdb.Get(path, nil, params...)
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	params = append(params, couchdb.Revision(rs.Revision()))
+	rs = cdb.Delete(path, nil, params...)
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	return nil
+}
+
+// CancelJobContext cancels the persistent replication job
+// using the passed context.
+func CancelJobContext(ctx context.Context, cdb couchdb.CouchDB, id string, params ...couchdb.Parameter) error {
+	return CancelJob(cdb.WithContext(ctx), id, params...)
+}
+
+// ListJobs returns the persistent replication jobs.
+func ListJobs(cdb couchdb.CouchDB, params ...couchdb.Parameter) (Jobs, error) {
+	params = append(params, couchdb.Query(couchdb.KeyValue{Key: "include_docs", Value: "true"}))
+	rs := cdb.Get(cdb.Path(ReplicatorDatabase, "_all_docs"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	rows := couchdbReplicatorRows{}
+	err := rs.Document(&rows)
+	if err != nil {
+		return nil, err
+	}
+	jobs := Jobs{}
+	for _, row := range rows.Rows {
+		if strings.HasPrefix(row.ID, "_design/") {
+			continue
+		}
+		jobs = append(jobs, Job{
+			ID:          row.ID,
+			Revision:    row.Document.Revision,
+			Replication: row.Document.Replication,
+		})
+	}
+	return jobs, nil
+}
+
+// ListJobsContext returns the persistent replication jobs
+// using the passed context.
+func ListJobsContext(ctx context.Context, cdb couchdb.CouchDB, params ...couchdb.Parameter) (Jobs, error) {
+	return ListJobs(cdb.WithContext(ctx), params...)
+}
+
+//--------------------
+// SCHEDULER FUNCTIONS
+//--------------------
+
+// ReadSchedulerJobs returns the replication jobs currently
+// handled by the scheduler.
+func ReadSchedulerJobs(cdb couchdb.CouchDB, params ...couchdb.Parameter) (SchedulerJobs, error) {
+	rs := cdb.Get(cdb.Path("_scheduler", "jobs"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	jobs := couchdbSchedulerJobs{}
+	err := rs.Document(&jobs)
+	if err != nil {
+		return nil, err
+	}
+	return jobs.Jobs, nil
+}
+
+// ReadSchedulerJobsContext returns the replication jobs currently
+// handled by the scheduler using the passed context.
+func ReadSchedulerJobsContext(ctx context.Context, cdb couchdb.CouchDB, params ...couchdb.Parameter) (SchedulerJobs, error) {
+	return ReadSchedulerJobs(cdb.WithContext(ctx), params...)
+}
+
+// ReadSchedulerDocuments returns the states of all persistent
+// replication jobs.
+func ReadSchedulerDocuments(cdb couchdb.CouchDB, params ...couchdb.Parameter) (SchedulerDocuments, error) {
+	rs := cdb.Get(cdb.Path("_scheduler", "docs"), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	docs := couchdbSchedulerDocuments{}
+	err := rs.Document(&docs)
+	if err != nil {
+		return nil, err
+	}
+	return docs.Documents, nil
+}
+
+// ReadSchedulerDocumentsContext returns the states of all persistent
+// replication jobs using the passed context.
+func ReadSchedulerDocumentsContext(ctx context.Context, cdb couchdb.CouchDB, params ...couchdb.Parameter) (SchedulerDocuments, error) {
+	return ReadSchedulerDocuments(cdb.WithContext(ctx), params...)
+}
+
+// ReadSchedulerDocument returns the state of the persistent
+// replication job with the given ID.
+func ReadSchedulerDocument(cdb couchdb.CouchDB, id string, params ...couchdb.Parameter) (*SchedulerDocument, error) {
+	rs := cdb.Get(cdb.Path("_scheduler", "docs", ReplicatorDatabase, id), nil, params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	doc := SchedulerDocument{}
+	err := rs.Document(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ReadSchedulerDocumentContext returns the state of the persistent
+// replication job using the passed context.
+func ReadSchedulerDocumentContext(ctx context.Context, cdb couchdb.CouchDB, id string, params ...couchdb.Parameter) (*SchedulerDocument, error) {
+	return ReadSchedulerDocument(cdb.WithContext(ctx), id, params...)
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// validate checks if the replication has a source and a target.
+func validate(r *Replication) error {
+	if r == nil || r.Source == nil || r.Target == nil || r.Source.URL == "" || r.Target.URL == "" {
+		return errors.New(ErrNoEndpoint, errorMessages)
+	}
+	return nil
+}
+
+// EOF
@@ -12,6 +12,8 @@ package security
 //--------------------
 
 import (
+	"context"
+
 	"github.com/tideland/gocouch/couchdb"
 )
 
@@ -32,6 +34,12 @@ func HasAdministrator(cdb couchdb.CouchDB, nodename, name string, params ...couc
 	return true, nil
 }
 
+// HasAdministratorContext checks if a given administrator account
+// exists using the passed context.
+func HasAdministratorContext(ctx context.Context, cdb couchdb.CouchDB, nodename, name string, params ...couchdb.Parameter) (bool, error) {
+	return HasAdministrator(cdb.WithContext(ctx), nodename, name, params...)
+}
+
 // WriteAdministrator adds or updates an administrator to the given database.
 func WriteAdministrator(cdb couchdb.CouchDB, nodename, name, password string, params ...couchdb.Parameter) error {
 	path := cdb.Path("_node", nodename, "_config", "admins", name)
@@ -42,6 +50,12 @@ func WriteAdministrator(cdb couchdb.CouchDB, nodename, name, password string, pa
 	return nil
 }
 
+// WriteAdministratorContext adds or updates an administrator to
+// the given database using the passed context.
+func WriteAdministratorContext(ctx context.Context, cdb couchdb.CouchDB, nodename, name, password string, params ...couchdb.Parameter) error {
+	return WriteAdministrator(cdb.WithContext(ctx), nodename, name, password, params...)
+}
+
 // DeleteAdministrator deletes an administrator from the given database.
 func DeleteAdministrator(cdb couchdb.CouchDB, nodename, name string, params ...couchdb.Parameter) error {
 	path := cdb.Path("_node", nodename, "_config", "admins", name)
@@ -52,6 +66,12 @@ func DeleteAdministrator(cdb couchdb.CouchDB, nodename, name string, params ...c
 	return nil
 }
 
+// DeleteAdministratorContext deletes an administrator from the
+// given database using the passed context.
+func DeleteAdministratorContext(ctx context.Context, cdb couchdb.CouchDB, nodename, name string, params ...couchdb.Parameter) error {
+	return DeleteAdministrator(cdb.WithContext(ctx), nodename, name, params...)
+}
+
 // CreateUser adds a new user to the system.
 func CreateUser(cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) error {
 	if err := ensureUsersDatabase(cdb); err != nil {
@@ -64,6 +84,12 @@ func CreateUser(cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) er
 	return rs.Error()
 }
 
+// CreateUserContext adds a new user to the system using the
+// passed context.
+func CreateUserContext(ctx context.Context, cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) error {
+	return CreateUser(cdb.WithContext(ctx), user, params...)
+}
+
 // ReadUser reads an existing user from the system.
 func ReadUser(cdb couchdb.CouchDB, name string, params ...couchdb.Parameter) (*User, error) {
 	path := cdb.Path("_users", userDocumentID(name))
@@ -79,6 +105,12 @@ func ReadUser(cdb couchdb.CouchDB, name string, params ...couchdb.Parameter) (*U
 	return &user, nil
 }
 
+// ReadUserContext reads an existing user from the system using
+// the passed context.
+func ReadUserContext(ctx context.Context, cdb couchdb.CouchDB, name string, params ...couchdb.Parameter) (*User, error) {
+	return ReadUser(cdb.WithContext(ctx), name, params...)
+}
+
 // UpdateUser updates a user in the system.
 func UpdateUser(cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) error {
 	if err := ensureUsersDatabase(cdb); err != nil {
@@ -92,6 +124,12 @@ func UpdateUser(cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) er
 	return nil
 }
 
+// UpdateUserContext updates a user in the system using the
+// passed context.
+func UpdateUserContext(ctx context.Context, cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) error {
+	return UpdateUser(cdb.WithContext(ctx), user, params...)
+}
+
 // DeleteUser deletes a user from the system.
 func DeleteUser(cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) error {
 	params = append(params, couchdb.Revision(user.DocumentRevision))
@@ -103,6 +141,12 @@ func DeleteUser(cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) er
 	return nil
 }
 
+// DeleteUserContext deletes a user from the system using the
+// passed context.
+func DeleteUserContext(ctx context.Context, cdb couchdb.CouchDB, user *User, params ...couchdb.Parameter) error {
+	return DeleteUser(cdb.WithContext(ctx), user, params...)
+}
+
 // ReadSecurity returns the security for the given database.
 func ReadSecurity(cdb couchdb.CouchDB, params ...couchdb.Parameter) (*Security, error) {
 	path := cdb.DatabasePath("_security")
@@ -118,6 +162,12 @@ func ReadSecurity(cdb couchdb.CouchDB, params ...couchdb.Parameter) (*Security,
 	return &security, nil
 }
 
+// ReadSecurityContext returns the security for the given database
+// using the passed context.
+func ReadSecurityContext(ctx context.Context, cdb couchdb.CouchDB, params ...couchdb.Parameter) (*Security, error) {
+	return ReadSecurity(cdb.WithContext(ctx), params...)
+}
+
 // WriteSecurity writes new or changed security data to
 // the given database.
 func WriteSecurity(cdb couchdb.CouchDB, security Security, params ...couchdb.Parameter) error {
@@ -129,6 +179,12 @@ func WriteSecurity(cdb couchdb.CouchDB, security Security, params ...couchdb.Par
 	return nil
 }
 
+// WriteSecurityContext writes new or changed security data to
+// the given database using the passed context.
+func WriteSecurityContext(ctx context.Context, cdb couchdb.CouchDB, security Security, params ...couchdb.Parameter) error {
+	return WriteSecurity(cdb.WithContext(ctx), security, params...)
+}
+
 //--------------------
 // HELPERS
 //--------------------
@@ -12,6 +12,7 @@ package security_test
 //--------------------
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -144,6 +145,11 @@ func TestSecurity(t *testing.T) {
 	// With database and without authentication.
 	rs := cdb.CreateDatabase()
 	assert.ErrorMatch(rs.Error(), ".*status code 401.*")
+	assert.True(couchdb.IsUnauthorized(rs.Error()))
+	reqErr, ok := couchdb.AsRequestError(rs.Error())
+	assert.True(ok)
+	assert.Equal(reqErr.StatusCode, couchdb.StatusUnauthorized)
+	assert.True(errors.Is(reqErr, couchdb.ErrUnauthorized))
 	rs = cdb.CreateDatabase(session.Cookie())
 	assert.True(rs.IsOK())
 	defer func() {
@@ -12,6 +12,7 @@ package security
 //--------------------
 
 import (
+	"context"
 	"strings"
 
 	"github.com/tideland/gocouch/couchdb"
@@ -72,6 +73,12 @@ func NewSession(cdb couchdb.CouchDB, name, password string) (Session, error) {
 	return s, nil
 }
 
+// NewSessionContext starts a cookie based session for the given user
+// using the passed context. It's also used when stopping the session.
+func NewSessionContext(ctx context.Context, cdb couchdb.CouchDB, name, password string) (Session, error) {
+	return NewSession(cdb.WithContext(ctx), name, password)
+}
+
 // Name implements the Session interface.
 func (s *session) Name() string {
 	return s.name
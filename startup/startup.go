@@ -12,6 +12,8 @@ package startup
 //--------------------
 
 import (
+	"context"
+
 	"github.com/tideland/golib/errors"
 	"github.com/tideland/golib/version"
 
@@ -127,4 +129,10 @@ func Run(cdb couchdb.CouchDB, steps ...Step) error {
 	return Steps(steps).run(cdb)
 }
 
+// RunContext works like Run but performs all requests, also those
+// of the step actions, using the passed context.
+func RunContext(ctx context.Context, cdb couchdb.CouchDB, steps ...Step) error {
+	return Run(cdb.WithContext(ctx), steps...)
+}
+
 // EOF
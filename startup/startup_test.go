@@ -15,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/tideland/golib/audit"
+	"github.com/tideland/golib/errors"
 	"github.com/tideland/golib/etc"
 	"github.com/tideland/golib/version"
 
@@ -130,6 +131,25 @@ func TestMultipleStartups(t *testing.T) {
 	assert.Length(ids, 4)
 }
 
+// TestFailingStep tests the error of a failing step.
+func TestFailingStep(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+
+	cfg, err := etc.ReadString(TemporaryDBCfg)
+	assert.Nil(err)
+
+	cdb, err := couchdb.Open(cfg)
+	assert.Nil(err)
+	defer func() { cdb.DeleteDatabase() }()
+
+	err = startup.Run(cdb, StepA, StepConflict)
+	assert.True(errors.IsError(err, startup.ErrStartupActionFailed))
+	assert.True(couchdb.IsConflict(err))
+	reqErr, ok := couchdb.AsRequestError(err)
+	assert.True(ok)
+	assert.Equal(reqErr.StatusCode, couchdb.StatusConflict)
+}
+
 //--------------------
 // HELPERS
 //--------------------
@@ -190,4 +210,20 @@ func StepC() (version.Version, startup.StepAction) {
 	}
 }
 
+func StepConflict() (version.Version, startup.StepAction) {
+	v := version.New(0, 2, 0)
+	return v, func(cdb couchdb.CouchDB) error {
+		md := MyDocument{
+			DocumentID: "my-document-a",
+			Name:       "Joe Black",
+			Age:        25,
+		}
+		resp := cdb.CreateDocument(&md)
+		if !resp.IsOK() {
+			return resp.Error()
+		}
+		return nil
+	}
+}
+
 // EOF
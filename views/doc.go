@@ -9,6 +9,13 @@
 // views. Currently those are created with design documents. Future
 // versions will contain functions for creation, modification, and
 // deletion of views too.
+//
+// Large views can be called with the parameter couchdb.Streaming().
+// Here the rows are decoded one by one while they arrive when calling
+// RowsDo().
+//
+// PartitionView() calls a view inside one partition of a partitioned
+// database.
 package views
 
 // EOF
@@ -12,6 +12,9 @@ package views
 //--------------------
 
 import (
+	"context"
+	"encoding/json"
+
 	"github.com/tideland/gocouch/couchdb"
 )
 
@@ -25,6 +28,24 @@ func View(cdb couchdb.CouchDB, design, view string, params ...couchdb.Parameter)
 	return newViewResultSet(rs)
 }
 
+// ViewContext performs a view request using the passed context.
+func ViewContext(ctx context.Context, cdb couchdb.CouchDB, design, view string, params ...couchdb.Parameter) ViewResultSet {
+	return View(cdb.WithContext(ctx), design, view, params...)
+}
+
+// PartitionView performs a view request in the partition of a
+// partitioned database.
+func PartitionView(cdb couchdb.CouchDB, partition, design, view string, params ...couchdb.Parameter) ViewResultSet {
+	rs := cdb.GetOrPost(cdb.PartitionPath(partition, "_design", design, "_view", view), nil, params...)
+	return newViewResultSet(rs)
+}
+
+// PartitionViewContext performs a view request in the partition
+// of a partitioned database using the passed context.
+func PartitionViewContext(ctx context.Context, cdb couchdb.CouchDB, partition, design, view string, params ...couchdb.Parameter) ViewResultSet {
+	return PartitionView(cdb.WithContext(ctx), partition, design, view, params...)
+}
+
 //--------------------
 // VIEW RESULT SET
 //--------------------
@@ -44,7 +65,9 @@ type ViewResultSet interface {
 	// Error returns a possible error of a request.
 	Error() error
 
-	// TotalRows returns the number of ViewResultSet rows.
+	// TotalRows returns the number of ViewResultSet rows. In
+	// streaming mode calling it before RowsDo() reads the
+	// whole result.
 	TotalRows() int
 
 	// ReturnedRows returns the nnumber of returned ViewResultSet rows.
@@ -54,14 +77,21 @@ type ViewResultSet interface {
 	Offset() int
 
 	// RowsDo iterates over the rows of a ViewResultSet and
-	// processes the content.
+	// processes the content. In streaming mode the rows are
+	// decoded while they arrive and can be iterated only once.
 	RowsDo(rpf RowProcessingFunc) error
+
+	// Close closes the result set in streaming mode if the
+	// rows are not iterated.
+	Close() error
 }
 
 // viewResultSet implements the ViewResultSet interface.
 type viewResultSet struct {
-	rs couchdb.ResultSet
-	vr *couchdbViewResult
+	rs       couchdb.ResultSet
+	vr       *couchdbViewResult
+	streamed *couchdbViewResult
+	returned int
 }
 
 // newViewResultSet returns a ChangesResultSet.
@@ -89,6 +119,9 @@ func (vrs *viewResultSet) Error() error {
 
 // TotalRows implements the ViewResultSet interface.
 func (vrs *viewResultSet) TotalRows() int {
+	if vrs.streamed != nil {
+		return vrs.streamed.TotalRows
+	}
 	if err := vrs.readViewResult(); err != nil {
 		return -1
 	}
@@ -97,6 +130,9 @@ func (vrs *viewResultSet) TotalRows() int {
 
 // ReturnedRows implements the ViewResultSet interface.
 func (vrs *viewResultSet) ReturnedRows() int {
+	if vrs.streamed != nil {
+		return vrs.returned
+	}
 	if err := vrs.readViewResult(); err != nil {
 		return -1
 	}
@@ -105,6 +141,9 @@ func (vrs *viewResultSet) ReturnedRows() int {
 
 // Offset implements the ViewResultSet interface.
 func (vrs *viewResultSet) Offset() int {
+	if vrs.streamed != nil {
+		return vrs.streamed.Offset
+	}
 	if err := vrs.readViewResult(); err != nil {
 		return -1
 	}
@@ -113,6 +152,9 @@ func (vrs *viewResultSet) Offset() int {
 
 // RowsDo implements the View interface.
 func (vrs *viewResultSet) RowsDo(rpf RowProcessingFunc) error {
+	if vrs.rs.IsStreamed() && vrs.vr == nil {
+		return vrs.streamRowsDo(rpf)
+	}
 	if err := vrs.readViewResult(); err != nil {
 		return err
 	}
@@ -127,6 +169,30 @@ func (vrs *viewResultSet) RowsDo(rpf RowProcessingFunc) error {
 	return nil
 }
 
+// Close implements the ViewResultSet interface.
+func (vrs *viewResultSet) Close() error {
+	return vrs.rs.Close()
+}
+
+// streamRowsDo decodes and processes the rows while reading
+// the streamed result.
+func (vrs *viewResultSet) streamRowsDo(rpf RowProcessingFunc) error {
+	vr := couchdbViewResult{}
+	vrs.streamed = &vr
+	vrs.returned = 0
+	return vrs.rs.RowsDo("rows", &vr, func(raw json.RawMessage) error {
+		row := couchdbViewRow{}
+		if err := couchdb.NewUnmarshableJSON(raw).Unmarshal(&row); err != nil {
+			return err
+		}
+		vrs.returned++
+		key := couchdb.NewUnmarshableJSON(row.Key)
+		value := couchdb.NewUnmarshableJSON(row.Value)
+		doc := couchdb.NewUnmarshableJSON(row.Document)
+		return rpf(row.ID, key, value, doc)
+	})
+}
+
 // readViewResult lazily reads the viewResultSet result.
 func (vrs *viewResultSet) readViewResult() error {
 	if !vrs.IsOK() {
@@ -12,6 +12,7 @@ package views_test
 //--------------------
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -139,6 +140,106 @@ func TestCallingView(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestViewError tests the error of calling a missing view.
+func TestViewError(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareFilledDatabase("view-error", assert)
+	defer cleanup()
+
+	vrs := views.View(cdb, "missing", "view")
+	assert.False(vrs.IsOK())
+	reqErr, ok := couchdb.AsRequestError(vrs.Error())
+	assert.True(ok)
+	assert.Equal(reqErr.StatusCode, couchdb.StatusNotFound)
+	assert.True(errors.Is(reqErr, couchdb.ErrNotFoundStatus))
+	assert.True(couchdb.IsNotFound(vrs.Error()))
+}
+
+// TestPartitionView tests calling a view inside a partition.
+func TestPartitionView(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cfgstr := strings.Replace(Cfg, "<<DATABASE>>", "view-partition", 1)
+	cfg, err := etc.ReadString(cfgstr)
+	assert.Nil(err)
+	cdb, err := couchdb.Open(cfg)
+	assert.Nil(err)
+	cdb.DeleteDatabase()
+	rs := cdb.CreateDatabase(couchdb.Partitioned())
+	assert.True(rs.IsOK())
+	defer cdb.DeleteDatabase()
+
+	design, err := cdb.Design("testing")
+	assert.Nil(err)
+	design.SetView("names", "function(doc){ emit(doc.name, null); }", "")
+	rs = design.Write()
+	assert.True(rs.IsOK())
+	for _, id := range []string{"eu:1", "eu:2", "us:1"} {
+		rs = cdb.CreateDocument(MyDocument{DocumentID: id, Name: id})
+		assert.True(rs.IsOK())
+	}
+	vrs := views.PartitionView(cdb, "eu", "testing", "names")
+	assert.True(vrs.IsOK())
+	assert.Equal(vrs.ReturnedRows(), 2)
+}
+
+// TestStreamingView tests calling a view in streaming mode.
+func TestStreamingView(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	cdb, cleanup := prepareFilledDatabase("view-streaming", assert)
+	defer cleanup()
+
+	// Create design document.
+	design, err := cdb.Design("testing")
+	assert.Nil(err)
+	design.SetView("age", "function(doc){ emit(doc.age, doc.name); }", "")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	// Stream all rows.
+	vrs := views.View(cdb, "testing", "age", couchdb.Streaming())
+	assert.True(vrs.IsOK())
+	rows := 0
+	err = vrs.RowsDo(func(id string, key, value, document couchdb.Unmarshable) error {
+		var age int
+		rows++
+		return key.Unmarshal(&age)
+	})
+	assert.Nil(err)
+	assert.Equal(rows, 1000)
+	assert.Equal(vrs.ReturnedRows(), 1000)
+	assert.Equal(vrs.TotalRows(), 1000)
+
+	// Rows can only be streamed once.
+	err = vrs.RowsDo(func(id string, key, value, document couchdb.Unmarshable) error {
+		return nil
+	})
+	assert.ErrorMatch(err, ".*stream of result set already consumed.*")
+
+	// Stop processing early.
+	errStop := errors.New("stop")
+	vrs = views.View(cdb, "testing", "age", couchdb.Streaming())
+	rows = 0
+	err = vrs.RowsDo(func(id string, key, value, document couchdb.Unmarshable) error {
+		rows++
+		if rows == 10 {
+			return errStop
+		}
+		return nil
+	})
+	assert.Equal(err, errStop)
+	assert.Equal(rows, 10)
+
+	// Stream all documents of the database.
+	rows = 0
+	err = cdb.AllDocumentsDo(func(id, revision string, document couchdb.Unmarshable) error {
+		rows++
+		assert.NotNil(document)
+		return nil
+	}, views.IncludeDocuments())
+	assert.Nil(err)
+	assert.Equal(rows, 1001)
+}
+
 //--------------------
 // HELPERS
 //--------------------